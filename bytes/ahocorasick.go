@@ -0,0 +1,131 @@
+package bytes
+
+// AhoCorasickMatch is a match of a pattern, the s[Start:End] equals the pattern.
+type AhoCorasickMatch struct {
+	// Pattern is the index of the pattern.
+	Pattern int
+	Start   int
+	End     int
+}
+
+// AhoCorasick searches multiple patterns in a single pass, the automaton is
+// compiled into a dense transition table, so the search costs one lookup per
+// byte. It is safe for concurrent use after created.
+//
+// NOTE that the dense table costs 1KiB per state, and there is one state per
+// distinct prefix of the patterns, so the total length of the patterns should be
+// small, e.g. 10k bytes of patterns may take up to 10MiB.
+type AhoCorasick struct {
+	lens    []int   // The lengths of patterns.
+	next    []int32 // next[state<<8|c] is the next state.
+	outputs [][]int // The indexes of patterns end at a state, longest first.
+}
+
+// NewAhoCorasick creates an AhoCorasick from the patterns, the empty patterns
+// are ignored. The patterns are not retained, but the building takes twice the
+// memory of the table temporarily.
+func NewAhoCorasick(patterns [][]byte) *AhoCorasick {
+	ac := &AhoCorasick{lens: make([]int, len(patterns))}
+
+	// Build the trie, the state 0 is the root, -1 means no edge.
+	children := [][256]int32{{}}
+	ac.outputs = [][]int{nil}
+	for i := range children[0] {
+		children[0][i] = -1
+	}
+	for index, pattern := range patterns {
+		ac.lens[index] = len(pattern)
+		if len(pattern) == 0 {
+			continue
+		}
+		state := int32(0)
+		for _, c := range pattern {
+			if children[state][c] < 0 {
+				var node [256]int32
+				for i := range node {
+					node[i] = -1
+				}
+				children = append(children, node)
+				ac.outputs = append(ac.outputs, nil)
+				children[state][c] = int32(len(children) - 1)
+			}
+			state = children[state][c]
+		}
+		ac.outputs[state] = append(ac.outputs[state], index)
+	}
+
+	// Compute the failure links by BFS and fill the missing edges, so that
+	// every state has 256 transitions.
+	fails := make([]int32, len(children))
+	queue := make([]int32, 0, len(children))
+	for c := 0; c < 256; c++ {
+		if child := children[0][c]; child < 0 {
+			children[0][c] = 0
+		} else {
+			queue = append(queue, child)
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		fail := fails[state]
+		ac.outputs[state] = append(ac.outputs[state], ac.outputs[fail]...)
+		for c := 0; c < 256; c++ {
+			if child := children[state][c]; child < 0 {
+				children[state][c] = children[fail][c]
+			} else {
+				fails[child] = children[fail][c]
+				queue = append(queue, child)
+			}
+		}
+	}
+
+	ac.next = make([]int32, len(children)<<8)
+	for state := range children {
+		copy(ac.next[state<<8:], children[state][:])
+	}
+	return ac
+}
+
+// Iterate iterates over all the matches in s, including the overlapping ones, in
+// the order of their end positions, it stops if fn returns false.
+func (ac *AhoCorasick) Iterate(s []byte, fn func(m AhoCorasickMatch) bool) {
+	state := int32(0)
+	for i, c := range s {
+		state = ac.next[int(state)<<8|int(c)]
+		for _, index := range ac.outputs[state] {
+			m := AhoCorasickMatch{Pattern: index, Start: i + 1 - ac.lens[index], End: i + 1}
+			if !fn(m) {
+				return
+			}
+		}
+	}
+}
+
+// FindAll returns all the matches in s, see Iterate.
+func (ac *AhoCorasick) FindAll(s []byte) []AhoCorasickMatch {
+	var matches []AhoCorasickMatch
+	ac.Iterate(s, func(m AhoCorasickMatch) bool {
+		matches = append(matches, m)
+		return true
+	})
+	return matches
+}
+
+// FindFirst returns the match which ends first in s, the longest pattern wins
+// if multiple patterns end at the same position.
+func (ac *AhoCorasick) FindFirst(s []byte) (AhoCorasickMatch, bool) {
+	var match AhoCorasickMatch
+	found := false
+	ac.Iterate(s, func(m AhoCorasickMatch) bool {
+		match, found = m, true
+		return false
+	})
+	return match, found
+}
+
+// Contains reports whether any pattern is in s.
+func (ac *AhoCorasick) Contains(s []byte) bool {
+	_, found := ac.FindFirst(s)
+	return found
+}
@@ -0,0 +1,70 @@
+package bytes
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAhoCorasick(t *testing.T) {
+	t.Parallel()
+
+	ac := NewAhoCorasick([][]byte{[]byte("he"), []byte("she"), []byte("his"), []byte("hers"), nil})
+	require.Equal(t, []AhoCorasickMatch{
+		{Pattern: 1, Start: 1, End: 4},
+		{Pattern: 0, Start: 2, End: 4},
+		{Pattern: 3, Start: 2, End: 6},
+	}, ac.FindAll([]byte("ushers")))
+
+	m, ok := ac.FindFirst([]byte("ahishe"))
+	require.True(t, ok)
+	require.Equal(t, AhoCorasickMatch{Pattern: 2, Start: 1, End: 4}, m)
+	require.True(t, ac.Contains([]byte("xhex")))
+	require.False(t, ac.Contains([]byte("hxsxe")))
+	require.Len(t, ac.FindAll(nil), 0)
+	require.False(t, NewAhoCorasick(nil).Contains([]byte("abc")))
+
+	// The patterns are not retained.
+	patterns := [][]byte{[]byte("abc")}
+	ac = NewAhoCorasick(patterns)
+	patterns[0] = nil
+	m, ok = ac.FindFirst([]byte("xabc"))
+	require.True(t, ok)
+	require.Equal(t, AhoCorasickMatch{Pattern: 0, Start: 1, End: 4}, m)
+}
+
+func TestAhoCorasickRandom(t *testing.T) {
+	t.Parallel()
+
+	rnd := rand.New(rand.NewSource(1))
+	randBytes := func(n int) []byte {
+		b := make([]byte, n)
+		for i := range b {
+			b[i] = "abc"[rnd.Intn(3)]
+		}
+		return b
+	}
+	for round := 0; round < 50; round++ {
+		patterns := make([][]byte, 1+rnd.Intn(8))
+		for i := range patterns {
+			patterns[i] = randBytes(1 + rnd.Intn(4))
+		}
+		s := randBytes(rnd.Intn(64))
+
+		count := 0
+		for i := range patterns {
+			for start := 0; start+len(patterns[i]) <= len(s); start++ {
+				if bytes.HasPrefix(s[start:], patterns[i]) {
+					count++
+				}
+			}
+		}
+		matches := NewAhoCorasick(patterns).FindAll(s)
+		require.Len(t, matches, count)
+		for _, m := range matches {
+			require.Equal(t, patterns[m.Pattern], s[m.Start:m.End])
+		}
+	}
+}
@@ -0,0 +1,160 @@
+package bytes
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrBudgetExceeded = errors.New("libext-go/bytes: byte budget exceeded")
+
+type budgetWaiter struct {
+	n     int
+	ready chan struct{}
+}
+
+// BudgetedSegmentsPool is a facade over SegmentsPool which bounds the total
+// capacity of the outstanding slices, the slices returned by Get are charged
+// against the budget and Put returns the credit. The waiters of Get are served
+// in FIFO order, so the large requests are not starved by the small ones.
+//
+// The used bytes may exceed the budget transiently if the adaptive size classes
+// are changed between the charging and the Get, see AdaptiveSegmentsPoolSizes.
+//
+// NOTE that the slice passed to Put must be the one returned by Get (it can be
+// resliced as long as its capacity is unchanged), and the slice must be Put
+// exactly once, otherwise the accounting is broken.
+type BudgetedSegmentsPool struct {
+	pool   *SegmentsPool
+	budget int
+
+	mu      sync.Mutex
+	used    int
+	waiters []*budgetWaiter
+}
+
+// NewBudgetedSegmentsPool creates a BudgetedSegmentsPool with the given budget
+// in bytes. NOTE that it will panic if the budget less than 1.
+func NewBudgetedSegmentsPool(pool *SegmentsPool, budget int) *BudgetedSegmentsPool {
+	if budget < 1 {
+		panic("libext-go/bytes: budget less than 1")
+	}
+	return &BudgetedSegmentsPool{pool: pool, budget: budget}
+}
+
+// Budget returns the budget in bytes.
+func (p *BudgetedSegmentsPool) Budget() int {
+	return p.budget
+}
+
+// Used returns the bytes charged by the outstanding slices.
+func (p *BudgetedSegmentsPool) Used() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.used
+}
+
+// Get returns a byte slice by given size, it blocks until the budget is
+// available or the context is done. It returns ErrBudgetExceeded immediately
+// if the capacity of the slice exceeds the whole budget.
+func (p *BudgetedSegmentsPool) Get(ctx context.Context, size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+	n := p.pool.capacityOf(size)
+	if n > p.budget {
+		return nil, ErrBudgetExceeded
+	}
+
+	p.mu.Lock()
+	if len(p.waiters) == 0 && p.used+n <= p.budget {
+		p.used += n
+		p.mu.Unlock()
+		return p.get(size, n), nil
+	}
+	w := &budgetWaiter{n: n, ready: make(chan struct{})}
+	p.waiters = append(p.waiters, w)
+	p.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return p.get(size, n), nil
+	case <-ctx.Done():
+	}
+
+	p.mu.Lock()
+	select {
+	case <-w.ready: // Granted in the meantime, give it back.
+		p.used -= n
+	default:
+		for i, waiter := range p.waiters {
+			if waiter == w {
+				p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+				break
+			}
+		}
+	}
+	p.notifyLocked()
+	p.mu.Unlock()
+	return nil, ctx.Err()
+}
+
+// TryGet is the same as Get, but it returns ErrBudgetExceeded instead of
+// blocking if the budget is not available.
+func (p *BudgetedSegmentsPool) TryGet(size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, nil
+	}
+	n := p.pool.capacityOf(size)
+
+	p.mu.Lock()
+	if len(p.waiters) > 0 || p.used+n > p.budget {
+		p.mu.Unlock()
+		return nil, ErrBudgetExceeded
+	}
+	p.used += n
+	p.mu.Unlock()
+	return p.get(size, n), nil
+}
+
+// get gets a slice from the pool which has been charged n bytes, the charge is
+// corrected if the size classes are changed in the meantime(only if the sizes are
+// adaptive), so the used bytes may exceed the budget transiently by the difference,
+// the later Get waits until it drops below the budget.
+func (p *BudgetedSegmentsPool) get(size, n int) []byte {
+	b := p.pool.Get(size)
+	if c := cap(b); c != n {
+		p.mu.Lock()
+		p.used += c - n
+		p.notifyLocked()
+		p.mu.Unlock()
+	}
+	return b
+}
+
+// Put puts the byte slice back into the pool and returns the credit.
+func (p *BudgetedSegmentsPool) Put(b []byte) {
+	n := cap(b)
+	if n == 0 {
+		return
+	}
+	p.pool.Put(b)
+
+	p.mu.Lock()
+	p.used -= n
+	p.notifyLocked()
+	p.mu.Unlock()
+}
+
+func (p *BudgetedSegmentsPool) notifyLocked() {
+	for len(p.waiters) > 0 {
+		w := p.waiters[0]
+		if p.used+w.n > p.budget {
+			return
+		}
+		p.used += w.n
+		p.waiters[0] = nil
+		p.waiters = p.waiters[1:]
+		close(w.ready)
+	}
+}
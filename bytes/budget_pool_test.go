@@ -0,0 +1,139 @@
+package bytes
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudgetedSegmentsPool(t *testing.T) {
+	t.Parallel()
+
+	p := NewBudgetedSegmentsPool(NewSegmentsPool(SegmentsPoolSizesFrom([]int{64, 256})), 576)
+	require.Equal(t, 576, p.Budget())
+	b1, err := p.TryGet(10)
+	require.Nil(t, err)
+	require.Equal(t, 64, cap(b1))
+	b2, err := p.TryGet(200)
+	require.Nil(t, err)
+	require.Equal(t, 320, p.Used())
+	b3, err := p.TryGet(150)
+	require.Nil(t, err)
+	require.Equal(t, 576, p.Used())
+	_, err = p.TryGet(1)
+	require.Equal(t, ErrBudgetExceeded, err)
+	_, err = p.Get(context.Background(), 577)
+	require.Equal(t, ErrBudgetExceeded, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Get(ctx, 1)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	p.Put(b1[:1])
+	require.Equal(t, 512, p.Used())
+	p.Put(b2)
+	p.Put(b3)
+	require.Equal(t, 0, p.Used())
+
+	b, err := p.Get(context.Background(), 0)
+	require.Nil(t, err)
+	require.Nil(t, b)
+}
+
+func waitBudgetWaiters(t *testing.T, p *BudgetedSegmentsPool, n int) {
+	for i := 0; ; i++ {
+		p.mu.Lock()
+		waiters := len(p.waiters)
+		p.mu.Unlock()
+		if waiters == n {
+			return
+		}
+		require.True(t, i < 1000, "waiters: %d", waiters)
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBudgetedSegmentsPoolBlocking(t *testing.T) {
+	t.Parallel()
+
+	p := NewBudgetedSegmentsPool(NewSegmentsPool(SegmentsPoolSizesFrom([]int{100})), 200)
+	b1, _ := p.TryGet(100)
+	b2, _ := p.TryGet(100)
+
+	bigc := make(chan []byte, 1)
+	bigErrc := make(chan error, 1)
+	go func() {
+		b, err := p.Get(context.Background(), 150)
+		bigErrc <- err
+		bigc <- b
+	}()
+	waitBudgetWaiters(t, p, 1)
+
+	// The waiters are served in FIFO order, the later ones can not jump the
+	// queue even if the budget is enough for them.
+	p.Put(b1)
+	_, err := p.TryGet(1)
+	require.Equal(t, ErrBudgetExceeded, err)
+	waitBudgetWaiters(t, p, 1)
+	require.Equal(t, 100, p.Used())
+	p.Put(b2)
+	require.Nil(t, <-bigErrc)
+	big := <-bigc
+	require.Equal(t, 150, cap(big))
+	require.Equal(t, 150, p.Used())
+
+	// Canceled waiter does not block the others.
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := p.Get(ctx, 100)
+		errc <- err
+	}()
+	waitBudgetWaiters(t, p, 1)
+	cancel()
+	require.Equal(t, context.Canceled, <-errc)
+	waitBudgetWaiters(t, p, 0)
+	p.Put(big)
+	b, err := p.TryGet(200)
+	require.Nil(t, err)
+	p.Put(b)
+	require.Equal(t, 0, p.Used())
+}
+
+func TestBudgetedSegmentsPoolConcurrent(t *testing.T) {
+	t.Parallel()
+
+	p := NewBudgetedSegmentsPool(NewSegmentsPool(SegmentsPoolRangeSizes(64, 1024, 64)), 4096)
+	var wg sync.WaitGroup
+	errc := make(chan error, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				b, err := p.Get(context.Background(), 1+(i*j)%2000)
+				if err != nil {
+					errc <- err
+					return
+				}
+				used := p.Used()
+				p.Put(b)
+				if used > p.Budget() {
+					errc <- fmt.Errorf("used %d exceeds the budget", used)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		require.Nil(t, err)
+	}
+	require.Equal(t, 0, p.Used())
+}
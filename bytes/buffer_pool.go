@@ -2,32 +2,244 @@ package bytes
 
 import (
 	"bytes"
+	"sort"
 	"sync"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	defaultBufferPoolCalibrateThreshold = 42000
+
+	// The calibration tracks the lengths in 20 classes: [0, 64], (64, 128], ...
+	calibrateMinBitSize       = 6
+	calibrateSteps            = 20
+	calibrateMaxPercentile    = 0.95
+	calibrateMinSize          = 1 << calibrateMinBitSize
+	calibrateMaxTrackedLength = calibrateMinSize << (calibrateSteps - 1)
+)
+
+type (
+	BufferPoolOptions struct {
+		stats              bool
+		maxCapacity        int
+		calibrate          bool
+		calibrateThreshold uint64
+	}
+	WithBufferPoolOption func(opts *BufferPoolOptions)
 )
 
+// WithBufferPoolStats enables the statistics, see BufferPool.Stats.
+func WithBufferPoolStats() WithBufferPoolOption {
+	return func(opts *BufferPoolOptions) {
+		opts.stats = true
+	}
+}
+
+// WithBufferPoolMaxCapacity drops the buffers whose capacity is greater than
+// the max capacity on Put, so a few large buffers can not pin the memory. Zero
+// means no limit.
+func WithBufferPoolMaxCapacity(capacity int) WithBufferPoolOption {
+	return func(opts *BufferPoolOptions) {
+		if capacity < 0 {
+			capacity = 0
+		}
+		opts.maxCapacity = capacity
+	}
+}
+
+// WithBufferPoolCalibration enables the calibration like the one in
+// valyala/bytebufferpool: the lengths of the buffers are tracked on Put, and
+// after a class of lengths has been seen threshold times, the most frequent
+// length becomes the initial capacity of the new buffers, and the buffers larger
+// than the 95th percentile are dropped on Put. The max capacity set by
+// WithBufferPoolMaxCapacity is still respected. It is ignored by SizedBufferPool.
+func WithBufferPoolCalibration(threshold uint64) WithBufferPoolOption {
+	return func(opts *BufferPoolOptions) {
+		if threshold == 0 {
+			threshold = defaultBufferPoolCalibrateThreshold
+		}
+		opts.calibrate = true
+		opts.calibrateThreshold = threshold
+	}
+}
+
+func makeBufferPoolOptions(opts ...WithBufferPoolOption) BufferPoolOptions {
+	var poolOpts BufferPoolOptions
+	for _, opt := range opts {
+		opt(&poolOpts)
+	}
+	return poolOpts
+}
+
+// BufferPoolStats is the snapshot of the statistics of a BufferPool.
+type BufferPoolStats struct {
+	Gets uint64
+	// Puts is the number of Put accepted by the pool.
+	Puts uint64
+	// News is the number of buffers allocated since the pool is empty,
+	// so the hits is Gets minus News.
+	News uint64
+	// Discards is the number of Put which is discarded since the capacity
+	// is too large or too small.
+	Discards uint64
+}
+
+type bufferPoolCounters struct {
+	gets     atomic.Uint64
+	puts     atomic.Uint64
+	news     atomic.Uint64
+	discards atomic.Uint64
+}
+
+func (c *bufferPoolCounters) snapshot() BufferPoolStats {
+	if c == nil {
+		return BufferPoolStats{}
+	}
+	return BufferPoolStats{
+		Gets:     c.gets.Load(),
+		Puts:     c.puts.Load(),
+		News:     c.news.Load(),
+		Discards: c.discards.Load(),
+	}
+}
+
 // BufferPool manages a pool of bytes.Buffer, the underlying pool is sync.Pool.
 type BufferPool struct {
-	pool sync.Pool
+	pool        sync.Pool
+	maxCapacity int
+	calibrator  *bufferPoolCalibrator // Nil if disabled.
+	stats       *bufferPoolCounters   // Nil if disabled.
 }
 
 // NewBufferPool returns a new BufferPool.
-func NewBufferPool() *BufferPool {
-	return &BufferPool{
-		pool: sync.Pool{
-			New: func() interface{} {
-				return &bytes.Buffer{}
-			},
-		},
+func NewBufferPool(opts ...WithBufferPoolOption) *BufferPool {
+	poolOpts := makeBufferPoolOptions(opts...)
+	p := &BufferPool{maxCapacity: poolOpts.maxCapacity}
+	if poolOpts.stats {
+		p.stats = &bufferPoolCounters{}
 	}
+	if poolOpts.calibrate {
+		p.calibrator = &bufferPoolCalibrator{threshold: poolOpts.calibrateThreshold}
+	}
+	p.pool.New = func() interface{} {
+		if p.stats != nil {
+			p.stats.news.Inc()
+		}
+		buf := &bytes.Buffer{}
+		if p.calibrator != nil {
+			if size := p.calibrator.defaultSize.Load(); size > 0 {
+				buf.Grow(int(size))
+			}
+		}
+		return buf
+	}
+	return p
 }
 
 // Get returns a bytes.Buffer from pool.
 func (p *BufferPool) Get() *bytes.Buffer {
+	if p.stats != nil {
+		p.stats.gets.Inc()
+	}
 	return p.pool.Get().(*bytes.Buffer)
 }
 
-// Put puts the bytes.Buffer back into pool.
+// Put puts the bytes.Buffer back into pool, it is dropped if the capacity
+// exceeds the max capacity.
 func (p *BufferPool) Put(buf *bytes.Buffer) {
+	maxCapacity := p.maxCapacity
+	if p.calibrator != nil {
+		p.calibrator.record(buf.Len())
+		if size := int(p.calibrator.maxSize.Load()); size > 0 && (maxCapacity == 0 || size < maxCapacity) {
+			maxCapacity = size
+		}
+	}
+	if maxCapacity > 0 && buf.Cap() > maxCapacity {
+		if p.stats != nil {
+			p.stats.discards.Inc()
+		}
+		return
+	}
+
+	if p.stats != nil {
+		p.stats.puts.Inc()
+	}
 	buf.Reset()
 	p.pool.Put(buf)
 }
+
+// Stats returns the snapshot of the statistics, it is empty if the statistics
+// is not enabled by WithBufferPoolStats.
+func (p *BufferPool) Stats() BufferPoolStats {
+	return p.stats.snapshot()
+}
+
+// NOTE that the 64-bit fields are placed first to be 8-byte aligned on 32-bit
+// platforms.
+type bufferPoolCalibrator struct {
+	defaultSize atomic.Int64
+	maxSize     atomic.Int64
+	calls       [calibrateSteps]atomic.Uint64
+	threshold   uint64
+	calibrating atomic.Bool
+}
+
+func calibrateIndex(n int) int {
+	n--
+	n >>= calibrateMinBitSize
+	index := 0
+	for n > 0 {
+		n >>= 1
+		index++
+	}
+	if index >= calibrateSteps {
+		index = calibrateSteps - 1
+	}
+	return index
+}
+
+func (c *bufferPoolCalibrator) record(n int) {
+	if c.calls[calibrateIndex(n)].Inc() > c.threshold {
+		c.calibrate()
+	}
+}
+
+func (c *bufferPoolCalibrator) calibrate() {
+	if !c.calibrating.CAS(false, true) {
+		return
+	}
+	defer c.calibrating.Store(false)
+
+	type callSize struct {
+		calls uint64
+		size  int
+	}
+	callSizes := make([]callSize, 0, calibrateSteps)
+	var callsSum uint64
+	for i := range c.calls {
+		calls := c.calls[i].Swap(0)
+		callsSum += calls
+		callSizes = append(callSizes, callSize{calls: calls, size: calibrateMinSize << uint(i)})
+	}
+	sort.Slice(callSizes, func(i, j int) bool { return callSizes[i].calls > callSizes[j].calls })
+
+	defaultSize := callSizes[0].size
+	maxSize := defaultSize
+	maxSum := uint64(float64(callsSum) * calibrateMaxPercentile)
+	callsSum = 0
+	for _, cs := range callSizes {
+		if callsSum > maxSum {
+			break
+		}
+		callsSum += cs.calls
+		if cs.size > maxSize {
+			maxSize = cs.size
+		}
+	}
+	if maxSize == calibrateMaxTrackedLength { // The largest class is unbounded.
+		maxSize = 0
+	}
+	c.defaultSize.Store(int64(defaultSize))
+	c.maxSize.Store(int64(maxSize))
+}
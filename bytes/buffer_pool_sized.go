@@ -0,0 +1,92 @@
+package bytes
+
+import (
+	"bytes"
+	"sync"
+)
+
+// SizedBufferPool manages bytes.Buffer by multiple sync.Pool, the pool is picked
+// by the expected size, so the small and large buffers are not mixed.
+type SizedBufferPool struct {
+	sizes       SegmentsPoolSizes
+	classSizes  []int
+	pools       []sync.Pool
+	maxCapacity int
+	stats       *bufferPoolCounters // Nil if disabled.
+}
+
+// NewSizedBufferPool creates a SizedBufferPool from given sizes, the buffers of
+// a class are allocated with the capacity of the class size. The sizes are copied,
+// so the later changes of the sizes, e.g. AdaptiveSegmentsPoolSizes, are not seen.
+func NewSizedBufferPool(sizes SegmentsPoolSizes, opts ...WithBufferPoolOption) *SizedBufferPool {
+	poolOpts := makeBufferPoolOptions(opts...)
+	p := &SizedBufferPool{maxCapacity: poolOpts.maxCapacity}
+	if poolOpts.stats {
+		p.stats = &bufferPoolCounters{}
+	}
+	sizes.Iterate(func(size int) bool {
+		p.classSizes = append(p.classSizes, size)
+		return true
+	})
+	p.sizes = SegmentsPoolSizesFrom(p.classSizes)
+	p.pools = make([]sync.Pool, len(p.classSizes))
+	for i, size := range p.classSizes {
+		size := size
+		p.pools[i].New = func() interface{} {
+			return p.newBuffer(size)
+		}
+	}
+	return p
+}
+
+func (p *SizedBufferPool) newBuffer(size int) *bytes.Buffer {
+	if p.stats != nil {
+		p.stats.news.Inc()
+	}
+	buf := &bytes.Buffer{}
+	buf.Grow(size)
+	return buf
+}
+
+// Get returns a bytes.Buffer whose capacity is at least sizeHint, the buffer
+// is not from pool if the sizeHint exceeds the largest class.
+func (p *SizedBufferPool) Get(sizeHint int) *bytes.Buffer {
+	if p.stats != nil {
+		p.stats.gets.Inc()
+	}
+	if sizeHint <= 0 {
+		sizeHint = 1
+	}
+	index, ok := p.sizes.Index(sizeHint)
+	if !ok {
+		return p.newBuffer(sizeHint)
+	}
+	return p.pools[index].Get().(*bytes.Buffer)
+}
+
+// Put puts the bytes.Buffer back into the pool of the largest class which is not
+// greater than its capacity. It is dropped if the capacity is less than the
+// smallest class, or greater than the largest class or the max capacity, so the
+// largest class is also a limit of the capacity.
+func (p *SizedBufferPool) Put(buf *bytes.Buffer) {
+	capacity := buf.Cap()
+	index, ok := floorClassIndex(p.sizes, p.classSizes, capacity)
+	if !ok || (p.maxCapacity > 0 && capacity > p.maxCapacity) {
+		if p.stats != nil {
+			p.stats.discards.Inc()
+		}
+		return
+	}
+
+	if p.stats != nil {
+		p.stats.puts.Inc()
+	}
+	buf.Reset()
+	p.pools[index].Put(buf)
+}
+
+// Stats returns the snapshot of the statistics, it is empty if the statistics
+// is not enabled by WithBufferPoolStats.
+func (p *SizedBufferPool) Stats() BufferPoolStats {
+	return p.stats.snapshot()
+}
@@ -0,0 +1,67 @@
+package bytes
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSizedBufferPool(t *testing.T) {
+	t.Parallel()
+
+	p := NewSizedBufferPool(SegmentsPoolSizesFrom([]int{128, 1024, 4096}), WithBufferPoolStats())
+	for _, c := range []struct {
+		sizeHint int
+		capacity int
+	}{{0, 128}, {1, 128}, {128, 128}, {129, 1024}, {4096, 4096}, {5000, 5000}} {
+		buf := p.Get(c.sizeHint)
+		require.True(t, buf.Cap() >= c.capacity, "%+v: %d", c, buf.Cap())
+		require.True(t, buf.Cap() < c.capacity*2, "%+v: %d", c, buf.Cap())
+		p.Put(buf)
+	}
+	stats := p.Stats()
+	require.Equal(t, uint64(6), stats.Gets)
+	require.Equal(t, uint64(5), stats.Puts)
+	require.Equal(t, uint64(1), stats.Discards)
+
+	// Grown buffers are pooled into the lower class.
+	buf := p.Get(128)
+	buf.Grow(2000)
+	p.Put(buf)
+	p.Put(&bytes.Buffer{})
+	require.Equal(t, uint64(6), p.Stats().Puts)
+	require.Equal(t, uint64(2), p.Stats().Discards)
+}
+
+func TestSizedBufferPoolMaxCapacity(t *testing.T) {
+	t.Parallel()
+
+	p := NewSizedBufferPool(SegmentsPoolSizesFrom([]int{128, 1024}), WithBufferPoolMaxCapacity(512), WithBufferPoolStats())
+	p.Put(p.Get(100))
+	p.Put(p.Get(1000))
+	stats := p.Stats()
+	require.Equal(t, uint64(1), stats.Puts)
+	require.Equal(t, uint64(1), stats.Discards)
+}
+
+func TestSizedBufferPoolAdaptiveSizes(t *testing.T) {
+	t.Parallel()
+
+	sizes := NewAdaptiveSegmentsPoolSizes([]int{64}, WithAdaptiveRecomputeInterval(0))
+	p := NewSizedBufferPool(sizes, WithBufferPoolStats())
+	for i := 0; i < 100; i++ {
+		sizes.Observe(10)
+		sizes.Observe(1000)
+	}
+	require.True(t, sizes.Recompute())
+
+	// The sizes are copied at creation.
+	p.Put(p.Get(1000))
+	buf := p.Get(10)
+	require.True(t, buf.Cap() >= 64, buf.Cap())
+	p.Put(buf)
+	stats := p.Stats()
+	require.Equal(t, uint64(1), stats.Puts)
+	require.Equal(t, uint64(1), stats.Discards)
+}
@@ -18,3 +18,74 @@ func TestBufferPool(t *testing.T) {
 		p.Put(b)
 	}
 }
+
+func TestBufferPoolStats(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, BufferPoolStats{}, NewBufferPool().Stats())
+
+	p := NewBufferPool(WithBufferPoolStats())
+	for i := 0; i < 10; i++ {
+		p.Put(p.Get())
+	}
+	stats := p.Stats()
+	require.Equal(t, uint64(10), stats.Gets)
+	require.Equal(t, uint64(10), stats.Puts)
+	require.True(t, stats.News >= 1 && stats.News <= 10)
+}
+
+func TestBufferPoolMaxCapacity(t *testing.T) {
+	t.Parallel()
+
+	p := NewBufferPool(WithBufferPoolMaxCapacity(1024), WithBufferPoolStats())
+	buf := p.Get()
+	buf.Grow(2048)
+	p.Put(buf)
+	buf = p.Get()
+	buf.Grow(512)
+	p.Put(buf)
+
+	stats := p.Stats()
+	require.Equal(t, uint64(1), stats.Puts)
+	require.Equal(t, uint64(1), stats.Discards)
+}
+
+func TestBufferPoolCalibration(t *testing.T) {
+	t.Parallel()
+
+	p := NewBufferPool(WithBufferPoolCalibration(100), WithBufferPoolStats())
+	for i := 0; i < 100; i++ {
+		buf := p.Get()
+		buf.Write(make([]byte, 1000))
+		p.Put(buf)
+	}
+	for i := 0; i < 5; i++ {
+		buf := p.Get()
+		buf.Write(make([]byte, 1<<20))
+		p.Put(buf)
+	}
+	require.Equal(t, int64(0), p.calibrator.maxSize.Load())
+
+	buf := p.Get()
+	buf.Write(make([]byte, 1000))
+	p.Put(buf) // Calibrated.
+	require.Equal(t, int64(1024), p.calibrator.defaultSize.Load())
+	require.Equal(t, int64(1024), p.calibrator.maxSize.Load())
+
+	discards := p.Stats().Discards
+	buf = p.Get()
+	buf.Write(make([]byte, 1<<20))
+	p.Put(buf)
+	require.Equal(t, discards+1, p.Stats().Discards)
+}
+
+func TestCalibrateIndex(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []struct {
+		n     int
+		index int
+	}{{0, 0}, {1, 0}, {64, 0}, {65, 1}, {128, 1}, {129, 2}, {1 << 30, calibrateSteps - 1}} {
+		require.Equal(t, c.index, calibrateIndex(c.n), "n: %d", c.n)
+	}
+}
@@ -0,0 +1,133 @@
+package bytes
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"unicode/utf8"
+)
+
+// SplitIterator iterates over the sub-slices separated by sep without allocating
+// a [][]byte, it yields the same sub-slices as bytes.Split:
+//
+//	it := NewSplitIterator(s, []byte(","))
+//	for part, ok := it.Next(); ok; part, ok = it.Next() {
+//		...
+//	}
+//
+// If the sep is empty, it splits after each UTF-8 sequence.
+type SplitIterator struct {
+	s    []byte
+	sep  []byte
+	done bool
+}
+
+// NewSplitIterator creates a SplitIterator.
+func NewSplitIterator(s, sep []byte) *SplitIterator {
+	return &SplitIterator{s: s, sep: sep, done: len(sep) == 0 && len(s) == 0}
+}
+
+// Next returns the next sub-slice, the ok is false if there is no more.
+func (it *SplitIterator) Next() (part []byte, ok bool) {
+	if it.done {
+		return nil, false
+	}
+	if len(it.sep) == 0 {
+		_, size := utf8.DecodeRune(it.s)
+		part, it.s = it.s[:size:size], it.s[size:]
+		it.done = len(it.s) == 0
+		return part, true
+	}
+
+	i := bytes.Index(it.s, it.sep)
+	if i < 0 {
+		part = it.s
+		it.s = nil
+		it.done = true
+		return part, true
+	}
+	part, it.s = it.s[:i:i], it.s[i+len(it.sep):]
+	return part, true
+}
+
+// ConstantTimeEqual reports whether a and b are equal, the time taken depends on
+// the length of the slices but not the contents, see crypto/subtle.
+func ConstantTimeEqual(a, b []byte) bool {
+	return subtle.ConstantTimeCompare(a, b) == 1
+}
+
+func lowerASCII(c byte) byte {
+	if 'A' <= c && c <= 'Z' {
+		return c + ('a' - 'A')
+	}
+	return c
+}
+
+func equalFoldASCII(a, b []byte) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] && lowerASCII(a[i]) != lowerASCII(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// HasPrefixFold reports whether s begins with prefix, the ASCII letters are
+// compared case-insensitively, others are compared byte by byte.
+func HasPrefixFold(s, prefix []byte) bool {
+	return len(s) >= len(prefix) && equalFoldASCII(s[:len(prefix)], prefix)
+}
+
+// HasSuffixFold reports whether s ends with suffix, the ASCII letters are
+// compared case-insensitively, others are compared byte by byte.
+func HasSuffixFold(s, suffix []byte) bool {
+	return len(s) >= len(suffix) && equalFoldASCII(s[len(s)-len(suffix):], suffix)
+}
+
+// ByteSet is a set of bytes, the zero value is an empty set.
+type ByteSet [8]uint32
+
+// NewByteSet creates a ByteSet from the given bytes.
+func NewByteSet(chars []byte) *ByteSet {
+	set := &ByteSet{}
+	for _, c := range chars {
+		set.Add(c)
+	}
+	return set
+}
+
+// Add adds the byte c into the set.
+func (set *ByteSet) Add(c byte) {
+	set[c>>5] |= 1 << (c & 31)
+}
+
+// Contains reports whether the byte c is in the set.
+func (set *ByteSet) Contains(c byte) bool {
+	return set[c>>5]&(1<<(c&31)) != 0
+}
+
+// TrimSet returns a sub-slice of s with the leading and trailing bytes in the
+// set removed.
+func TrimSet(s []byte, set *ByteSet) []byte {
+	return TrimRightSet(TrimLeftSet(s, set), set)
+}
+
+// TrimLeftSet returns a sub-slice of s with the leading bytes in the set removed.
+func TrimLeftSet(s []byte, set *ByteSet) []byte {
+	i := 0
+	for i < len(s) && set.Contains(s[i]) {
+		i++
+	}
+	return s[i:]
+}
+
+// TrimRightSet returns a sub-slice of s with the trailing bytes in the set removed.
+func TrimRightSet(s []byte, set *ByteSet) []byte {
+	i := len(s)
+	for i > 0 && set.Contains(s[i-1]) {
+		i--
+	}
+	return s[:i]
+}
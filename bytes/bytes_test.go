@@ -0,0 +1,73 @@
+package bytes
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitIterator(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []struct {
+		s   string
+		sep string
+	}{
+		{"", ","}, {"a", ","}, {"a,b,c", ","}, {",a,,b,", ","}, {"a::b::", "::"},
+		{"", ""}, {"abc", ""}, {"a世b", ""}, {"a\xffb", ""},
+	} {
+		expected := bytes.Split([]byte(c.s), []byte(c.sep))
+		parts := [][]byte{}
+		it := NewSplitIterator([]byte(c.s), []byte(c.sep))
+		for part, ok := it.Next(); ok; part, ok = it.Next() {
+			parts = append(parts, part)
+		}
+		require.Equal(t, expected, parts, "%+v", c)
+		_, ok := it.Next()
+		require.False(t, ok)
+	}
+
+	// The parts can not overwrite the rest.
+	s := []byte("a,b")
+	part, _ := NewSplitIterator(s, []byte(",")).Next()
+	_ = append(part, 'x')
+	require.Equal(t, "a,b", string(s))
+}
+
+func TestConstantTimeEqual(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, ConstantTimeEqual(nil, []byte{}))
+	require.True(t, ConstantTimeEqual([]byte("secret"), []byte("secret")))
+	require.False(t, ConstantTimeEqual([]byte("secret"), []byte("Secret")))
+	require.False(t, ConstantTimeEqual([]byte("secret"), []byte("secret!")))
+}
+
+func TestHasPrefixSuffixFold(t *testing.T) {
+	t.Parallel()
+
+	require.True(t, HasPrefixFold([]byte("Content-Type: text"), []byte("content-type:")))
+	require.True(t, HasPrefixFold([]byte("abc"), nil))
+	require.False(t, HasPrefixFold([]byte("ab"), []byte("abc")))
+	require.False(t, HasPrefixFold([]byte("a[c"), []byte("A{C")))
+	require.True(t, HasSuffixFold([]byte("index.HTML"), []byte(".html")))
+	require.False(t, HasSuffixFold([]byte("index.htm"), []byte(".html")))
+	require.False(t, HasSuffixFold([]byte("\xc3\x89"), []byte("\xc3\xa9"))) // Non-ASCII.
+}
+
+func TestTrimSet(t *testing.T) {
+	t.Parallel()
+
+	set := NewByteSet([]byte(" \t\r\n"))
+	require.True(t, set.Contains('\t'))
+	require.False(t, set.Contains('a'))
+	require.True(t, NewByteSet([]byte{0, 255}).Contains(255))
+
+	s := []byte(" \t hello world\r\n")
+	require.Equal(t, "hello world", string(TrimSet(s, set)))
+	require.Equal(t, "hello world\r\n", string(TrimLeftSet(s, set)))
+	require.Equal(t, " \t hello world", string(TrimRightSet(s, set)))
+	require.Len(t, TrimSet([]byte(" \n "), set), 0)
+	require.Equal(t, "x", string(TrimSet([]byte("x"), &ByteSet{})))
+}
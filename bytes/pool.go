@@ -0,0 +1,148 @@
+package bytes
+
+import (
+	"sync"
+)
+
+type (
+	PoolOptions struct {
+		stats   bool
+		maxIdle int
+	}
+	WithPoolOption func(opts *PoolOptions)
+)
+
+// WithPoolStats enables the statistics, see Pool.Stats.
+func WithPoolStats() WithPoolOption {
+	return func(opts *PoolOptions) {
+		opts.stats = true
+	}
+}
+
+// WithPoolMaxIdle keeps at most n idle objects in a free list, which is not
+// cleared by GC like sync.Pool, the objects beyond that go to the sync.Pool.
+// Zero means no free list.
+func WithPoolMaxIdle(n int) WithPoolOption {
+	return func(opts *PoolOptions) {
+		if n < 0 {
+			n = 0
+		}
+		opts.maxIdle = n
+	}
+}
+
+func makePoolOptions(opts ...WithPoolOption) PoolOptions {
+	var poolOpts PoolOptions
+	for _, opt := range opts {
+		opt(&poolOpts)
+	}
+	return poolOpts
+}
+
+// PoolStats is the snapshot of the statistics of a Pool.
+type PoolStats struct {
+	Gets uint64
+	Puts uint64
+	// News is the number of objects created since the pool is empty,
+	// so the hits is Gets minus News.
+	News uint64
+	// Idle is the number of objects in the free list.
+	Idle int
+}
+
+// Pool is a typed object pool, the underlying pool is sync.Pool with an optional
+// free list, see WithPoolMaxIdle. The T should be a pointer-like type, otherwise
+// the sync.Pool allocates on each Put.
+type Pool[T any] struct {
+	newFunc func() T
+	reset   func(T)
+	maxIdle int
+	stats   *bufferPoolCounters // Nil if disabled.
+
+	pool sync.Pool
+	mu   sync.Mutex // Guards the free list.
+	idle []T
+}
+
+// NewPool creates a Pool, the newFunc creates a new object if the pool is empty,
+// the reset resets the object on Put, it can be nil.
+func NewPool[T any](newFunc func() T, reset func(T), opts ...WithPoolOption) *Pool[T] {
+	poolOpts := makePoolOptions(opts...)
+	p := &Pool[T]{
+		newFunc: newFunc,
+		reset:   reset,
+		maxIdle: poolOpts.maxIdle,
+	}
+	if poolOpts.stats {
+		p.stats = &bufferPoolCounters{}
+	}
+	if p.maxIdle > 0 {
+		p.idle = make([]T, 0, p.maxIdle)
+	}
+	return p
+}
+
+// Get returns an object from the free list first, then the sync.Pool, it is
+// created by newFunc if both are empty.
+func (p *Pool[T]) Get() T {
+	if p.stats != nil {
+		p.stats.gets.Inc()
+	}
+	if p.maxIdle > 0 {
+		p.mu.Lock()
+		if n := len(p.idle); n > 0 {
+			v := p.idle[n-1]
+			var zero T
+			p.idle[n-1] = zero
+			p.idle = p.idle[:n-1]
+			p.mu.Unlock()
+			return v
+		}
+		p.mu.Unlock()
+	}
+
+	if v, ok := p.pool.Get().(T); ok {
+		return v
+	}
+	if p.stats != nil {
+		p.stats.news.Inc()
+	}
+	return p.newFunc()
+}
+
+// Put resets the object and puts it back into pool.
+func (p *Pool[T]) Put(v T) {
+	if p.stats != nil {
+		p.stats.puts.Inc()
+	}
+	if p.reset != nil {
+		p.reset(v)
+	}
+	if p.maxIdle > 0 {
+		p.mu.Lock()
+		if len(p.idle) < p.maxIdle {
+			p.idle = append(p.idle, v)
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+	}
+	p.pool.Put(v)
+}
+
+// Stats returns the snapshot of the statistics, it is empty if the statistics
+// is not enabled by WithPoolStats.
+func (p *Pool[T]) Stats() PoolStats {
+	if p.stats == nil {
+		return PoolStats{}
+	}
+	p.mu.Lock()
+	idle := len(p.idle)
+	p.mu.Unlock()
+	return PoolStats{
+		Gets: p.stats.gets.Load(),
+		Puts: p.stats.puts.Load(),
+		News: p.stats.news.Load(),
+		Idle: idle,
+	}
+}
@@ -0,0 +1,92 @@
+package bytes
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type poolTestObject struct {
+	values []int
+}
+
+func newPoolTestPool(opts ...WithPoolOption) *Pool[*poolTestObject] {
+	return NewPool(
+		func() *poolTestObject { return &poolTestObject{values: make([]int, 0, 8)} },
+		func(o *poolTestObject) { o.values = o.values[:0] },
+		opts...,
+	)
+}
+
+func TestPool(t *testing.T) {
+	t.Parallel()
+
+	p := newPoolTestPool(WithPoolMaxIdle(2), WithPoolStats())
+	o := p.Get()
+	o.values = append(o.values, 1, 2, 3)
+	p.Put(o)
+	require.Equal(t, 1, p.Stats().Idle)
+
+	o2 := p.Get()
+	require.True(t, o == o2)
+	require.Len(t, o2.values, 0)
+	require.Equal(t, 0, p.Stats().Idle)
+
+	objs := []*poolTestObject{o2, p.Get(), p.Get()}
+	for _, o := range objs {
+		p.Put(o)
+	}
+	require.Equal(t, 2, p.Stats().Idle)
+
+	runtime.GC()
+	runtime.GC()
+	// The free list survives GC.
+	require.True(t, p.Get() == objs[1])
+	require.True(t, p.Get() == objs[0])
+
+	stats := p.Stats()
+	require.Equal(t, uint64(6), stats.Gets)
+	require.Equal(t, uint64(4), stats.Puts)
+	require.True(t, stats.News >= 3 && stats.News <= 4)
+	require.Equal(t, PoolStats{}, newPoolTestPool().Stats())
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	t.Parallel()
+
+	p := newPoolTestPool(WithPoolMaxIdle(4))
+	var wg sync.WaitGroup
+	errc := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				o := p.Get()
+				if n := len(o.values); n != 0 {
+					errc <- fmt.Errorf("the object is not reset: %d values", n)
+					return
+				}
+				o.values = append(o.values, j)
+				p.Put(o)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errc)
+	for err := range errc {
+		require.Nil(t, err)
+	}
+}
+
+func TestPoolWithoutReset(t *testing.T) {
+	t.Parallel()
+
+	p := NewPool(func() []byte { return make([]byte, 4) }, nil)
+	b := p.Get()
+	require.Len(t, b, 4)
+	p.Put(b)
+}
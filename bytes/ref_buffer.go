@@ -0,0 +1,156 @@
+package bytes
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+// RefBuffer is a reference-counted byte slice from a SegmentsPool, it returns
+// the slice to the pool once the count reaches zero. It is useful if a slice
+// is shared by multiple consumers, each one calls Retain before handing it off,
+// and calls Release once done.
+//
+// NOTE that the slice must not be used after the last Release.
+type RefBuffer struct {
+	b        []byte
+	pool     *SegmentsPool
+	refs     atomic.Int32
+	detector *LeakDetector // Nil if not tracked.
+}
+
+// GetRef returns a RefBuffer with the count of one, the length of its Bytes is
+// the given size, the negative size is treated as zero.
+func (p *SegmentsPool) GetRef(size int) *RefBuffer {
+	if size < 0 {
+		size = 0
+	}
+	rb := &RefBuffer{b: p.Get(size)[:size], pool: p}
+	rb.refs.Store(1)
+	if p.opts.leakDetector != nil {
+		rb.detector = p.opts.leakDetector
+		rb.detector.track(rb, size)
+	}
+	return rb
+}
+
+// Bytes returns the underlying byte slice.
+func (rb *RefBuffer) Bytes() []byte {
+	return rb.b
+}
+
+// Len returns the length of the underlying byte slice.
+func (rb *RefBuffer) Len() int {
+	return len(rb.b)
+}
+
+// Refs returns the current count.
+func (rb *RefBuffer) Refs() int {
+	return int(rb.refs.Load())
+}
+
+// Retain increments the count, it panics if the buffer has been released.
+func (rb *RefBuffer) Retain() *RefBuffer {
+	if rb.refs.Inc() <= 1 {
+		panic("libext-go/bytes: retain a released RefBuffer")
+	}
+	return rb
+}
+
+// Release decrements the count and reports whether the buffer is returned to
+// the pool, it panics if the buffer has been released.
+func (rb *RefBuffer) Release() bool {
+	refs := rb.refs.Dec()
+	if refs > 0 {
+		return false
+	}
+	if refs < 0 {
+		panic("libext-go/bytes: release a released RefBuffer")
+	}
+
+	if rb.detector != nil {
+		rb.detector.untrack(rb)
+	}
+	b := rb.b
+	rb.b = nil
+	rb.pool.Put(b)
+	return true
+}
+
+// RefBufferLeak is a RefBuffer which is never released.
+type RefBufferLeak struct {
+	Size int
+	// Stack is the stack trace where the buffer is created.
+	Stack string
+}
+
+// LeakDetector tracks the RefBuffers created by the SegmentsPool with the
+// WithSegmentsPoolLeakDetector option and reports the ones never released.
+// It records a stack trace for each buffer, so it is only meant for testing.
+type LeakDetector struct {
+	mu      sync.Mutex
+	buffers map[*RefBuffer]RefBufferLeak
+}
+
+// NewLeakDetector creates a LeakDetector.
+func NewLeakDetector() *LeakDetector {
+	return &LeakDetector{buffers: make(map[*RefBuffer]RefBufferLeak)}
+}
+
+func (d *LeakDetector) track(rb *RefBuffer, size int) {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs) // Skip runtime.Callers, track and GetRef.
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack strings.Builder
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&stack, "%s\n\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+
+	d.mu.Lock()
+	d.buffers[rb] = RefBufferLeak{Size: size, Stack: stack.String()}
+	d.mu.Unlock()
+}
+
+func (d *LeakDetector) untrack(rb *RefBuffer) {
+	d.mu.Lock()
+	delete(d.buffers, rb)
+	d.mu.Unlock()
+}
+
+// Leaks returns the buffers which are not released yet, sorted by the stack.
+func (d *LeakDetector) Leaks() []RefBufferLeak {
+	d.mu.Lock()
+	leaks := make([]RefBufferLeak, 0, len(d.buffers))
+	for _, leak := range d.buffers {
+		leaks = append(leaks, leak)
+	}
+	d.mu.Unlock()
+
+	sort.Slice(leaks, func(i, j int) bool { return leaks[i].Stack < leaks[j].Stack })
+	return leaks
+}
+
+// Check returns an error describing the leaks if any, it is handy in tests:
+//
+//	defer func() { require.Nil(t, detector.Check()) }()
+func (d *LeakDetector) Check() error {
+	leaks := d.Leaks()
+	if len(leaks) == 0 {
+		return nil
+	}
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "libext-go/bytes: %d RefBuffer(s) leaked", len(leaks))
+	for _, leak := range leaks {
+		fmt.Fprintf(&sb, "\n\nsize %d, created at:\n%s", leak.Size, leak.Stack)
+	}
+	return errors.New(sb.String())
+}
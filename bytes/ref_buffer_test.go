@@ -0,0 +1,78 @@
+package bytes
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefBuffer(t *testing.T) {
+	t.Parallel()
+
+	p := NewSegmentsPool(SegmentsPoolSizesFrom([]int{64}), WithSegmentsPoolStats())
+	rb := p.GetRef(10)
+	require.Equal(t, 10, rb.Len())
+	require.Equal(t, 64, cap(rb.Bytes()))
+	require.Equal(t, 1, rb.Refs())
+
+	rb.Retain().Retain()
+	require.Equal(t, 3, rb.Refs())
+	require.False(t, rb.Release())
+	require.False(t, rb.Release())
+	require.Equal(t, uint64(0), p.Stats().Classes[0].Puts)
+	require.True(t, rb.Release())
+	require.Nil(t, rb.Bytes())
+	require.Equal(t, uint64(1), p.Stats().Classes[0].Puts)
+
+	require.Panics(t, func() { rb.Release() })
+	require.Panics(t, func() { rb.Retain() })
+
+	rb = p.GetRef(-1)
+	require.Equal(t, 0, rb.Len())
+	require.True(t, rb.Release())
+}
+
+func TestRefBufferConcurrent(t *testing.T) {
+	t.Parallel()
+
+	detector := NewLeakDetector()
+	p := NewSegmentsPool(SegmentsPoolSizesFrom([]int{64}), WithSegmentsPoolLeakDetector(detector))
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		rb := p.GetRef(32)
+		for j := 0; j < 4; j++ {
+			wg.Add(1)
+			go func(rb *RefBuffer) {
+				defer wg.Done()
+				defer rb.Release()
+				_ = rb.Bytes()[0]
+			}(rb.Retain())
+		}
+		rb.Release()
+	}
+	wg.Wait()
+	require.Nil(t, detector.Check())
+}
+
+func TestLeakDetector(t *testing.T) {
+	t.Parallel()
+
+	detector := NewLeakDetector()
+	p := NewSegmentsPool(SegmentsPoolSizesFrom([]int{64}), WithSegmentsPoolLeakDetector(detector))
+	p.GetRef(16).Release()
+	leaked := p.GetRef(8)
+	leaked.Retain()
+	leaked.Release()
+
+	leaks := detector.Leaks()
+	require.Len(t, leaks, 1)
+	require.Equal(t, 8, leaks[0].Size)
+	require.Contains(t, leaks[0].Stack, "TestLeakDetector")
+	err := detector.Check()
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "1 RefBuffer(s) leaked")
+
+	leaked.Release()
+	require.Nil(t, detector.Check())
+}
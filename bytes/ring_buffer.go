@@ -0,0 +1,371 @@
+package bytes
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	ErrRingBufferFull   = errors.New("libext-go/bytes: ring buffer is full")
+	ErrRingBufferClosed = errors.New("libext-go/bytes: ring buffer is closed")
+)
+
+type (
+	RingBufferOptions struct {
+		overwrite bool
+	}
+	WithRingBufferOption func(opts *RingBufferOptions)
+)
+
+// WithRingBufferOverwrite overwrites the oldest data if the buffer is full,
+// instead of failing the Write with ErrRingBufferFull.
+func WithRingBufferOverwrite() WithRingBufferOption {
+	return func(opts *RingBufferOptions) {
+		opts.overwrite = true
+	}
+}
+
+func makeRingBufferOptions(opts ...WithRingBufferOption) RingBufferOptions {
+	var ringOpts RingBufferOptions
+	for _, opt := range opts {
+		opt(&ringOpts)
+	}
+	return ringOpts
+}
+
+// RingBuffer is a fixed-capacity byte ring buffer, it is not thread-safe, see
+// BlockingRingBuffer for the thread-safe one.
+//
+// NOTE that the slices returned by Peek, ReadableSlices and WritableSlices are
+// only valid until the next modification of the buffer.
+type RingBuffer struct {
+	opts RingBufferOptions
+	buf  []byte
+	r    int // The read index.
+	n    int // The number of readable bytes.
+}
+
+// NewRingBuffer creates a RingBuffer with the given capacity. NOTE that it will
+// panic if the capacity less than 1.
+func NewRingBuffer(capacity int, opts ...WithRingBufferOption) *RingBuffer {
+	if capacity < 1 {
+		panic("libext-go/bytes: capacity less than 1")
+	}
+	return &RingBuffer{
+		opts: makeRingBufferOptions(opts...),
+		buf:  make([]byte, capacity),
+	}
+}
+
+// Len returns the number of the readable bytes.
+func (rb *RingBuffer) Len() int {
+	return rb.n
+}
+
+// Cap returns the capacity.
+func (rb *RingBuffer) Cap() int {
+	return len(rb.buf)
+}
+
+// Free returns the number of the writable bytes.
+func (rb *RingBuffer) Free() int {
+	return len(rb.buf) - rb.n
+}
+
+// Reset discards all the data.
+func (rb *RingBuffer) Reset() {
+	rb.r = 0
+	rb.n = 0
+}
+
+// views returns the two slices of the region [start, start+n) in the ring.
+func (rb *RingBuffer) views(start, n int) ([]byte, []byte) {
+	if n == 0 {
+		return nil, nil
+	}
+	if end := start + n; end <= len(rb.buf) {
+		return rb.buf[start:end], nil
+	}
+	return rb.buf[start:], rb.buf[:start+n-len(rb.buf)]
+}
+
+// ReadableSlices returns the readable region as two slices without copying, the
+// second one is not empty only if the region wraps around.
+func (rb *RingBuffer) ReadableSlices() ([]byte, []byte) {
+	return rb.views(rb.r, rb.n)
+}
+
+// WritableSlices returns the writable region as two slices without copying, the
+// data written into them must be committed by CommitWrite.
+func (rb *RingBuffer) WritableSlices() ([]byte, []byte) {
+	return rb.views((rb.r+rb.n)%len(rb.buf), rb.Free())
+}
+
+// CommitWrite makes the n bytes written into WritableSlices readable. NOTE that
+// it will panic if n is greater than Free.
+func (rb *RingBuffer) CommitWrite(n int) {
+	if n < 0 || n > rb.Free() {
+		panic("libext-go/bytes: commit more than free space")
+	}
+	rb.n += n
+}
+
+// Write writes the p into the buffer. If the buffer is full, it writes as much
+// as possible and returns ErrRingBufferFull, or overwrites the oldest data if
+// WithRingBufferOverwrite is used.
+func (rb *RingBuffer) Write(p []byte) (int, error) {
+	if !rb.opts.overwrite {
+		n := rb.write(p)
+		if n < len(p) {
+			return n, ErrRingBufferFull
+		}
+		return n, nil
+	}
+
+	written := len(p)
+	if len(p) >= len(rb.buf) {
+		p = p[len(p)-len(rb.buf):]
+		rb.Reset()
+	}
+	if over := len(p) - rb.Free(); over > 0 {
+		rb.discard(over)
+	}
+	rb.write(p)
+	return written, nil
+}
+
+func (rb *RingBuffer) write(p []byte) int {
+	first, second := rb.WritableSlices()
+	n := copy(first, p)
+	n += copy(second, p[n:])
+	rb.n += n
+	return n
+}
+
+// WriteByte writes a byte into the buffer, see Write.
+func (rb *RingBuffer) WriteByte(c byte) error {
+	_, err := rb.Write([]byte{c})
+	return err
+}
+
+// Read reads the next len(p) bytes from the buffer or until the buffer is drained,
+// the err is io.EOF if the buffer is empty.
+func (rb *RingBuffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if rb.n == 0 {
+		return 0, io.EOF
+	}
+	first, second := rb.ReadableSlices()
+	n := copy(p, first)
+	n += copy(p[n:], second)
+	rb.discard(n)
+	return n, nil
+}
+
+// ReadByte reads and returns the next byte from the buffer, the err is io.EOF
+// if the buffer is empty.
+func (rb *RingBuffer) ReadByte() (byte, error) {
+	if rb.n == 0 {
+		return 0, io.EOF
+	}
+	c := rb.buf[rb.r]
+	rb.discard(1)
+	return c, nil
+}
+
+// Peek returns the next n bytes without advancing the reader, the data is copied
+// if it wraps around. If Peek returns fewer than n bytes, the err is io.EOF.
+func (rb *RingBuffer) Peek(n int) ([]byte, error) {
+	var err error
+	if n > rb.n {
+		n = rb.n
+		err = io.EOF
+	}
+	if n <= 0 {
+		return nil, err
+	}
+	first, second := rb.views(rb.r, n)
+	if len(second) == 0 {
+		return first, err
+	}
+	p := make([]byte, 0, n)
+	p = append(p, first...)
+	return append(p, second...), err
+}
+
+// Discard skips the next n bytes, the err is io.EOF if the buffer has fewer than
+// n bytes.
+func (rb *RingBuffer) Discard(n int) (int, error) {
+	var err error
+	if n > rb.n {
+		n = rb.n
+		err = io.EOF
+	}
+	if n <= 0 {
+		return 0, err
+	}
+	rb.discard(n)
+	return n, err
+}
+
+func (rb *RingBuffer) discard(n int) {
+	rb.r = (rb.r + n) % len(rb.buf)
+	rb.n -= n
+	if rb.n == 0 {
+		rb.r = 0 // Keep the region contiguous as possible.
+	}
+}
+
+// BlockingRingBuffer is a thread-safe RingBuffer, the Read blocks until some data
+// is available and the Write blocks until all the data is written, so it can be
+// used as an in-process pipe.
+//
+// After Close, the Read returns the remaining data and then io.EOF, the Write
+// returns ErrRingBufferClosed. If WithRingBufferOverwrite is used, the Write
+// never blocks.
+type BlockingRingBuffer struct {
+	mu       sync.Mutex
+	readable *sync.Cond
+	writable *sync.Cond
+	rb       *RingBuffer
+	err      error // The error returned by Read after drained.
+}
+
+// NewBlockingRingBuffer creates a BlockingRingBuffer with the given capacity.
+// NOTE that it will panic if the capacity less than 1.
+func NewBlockingRingBuffer(capacity int, opts ...WithRingBufferOption) *BlockingRingBuffer {
+	b := &BlockingRingBuffer{rb: NewRingBuffer(capacity, opts...)}
+	b.readable = sync.NewCond(&b.mu)
+	b.writable = sync.NewCond(&b.mu)
+	return b
+}
+
+// Len returns the number of the readable bytes.
+func (b *BlockingRingBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.rb.Len()
+}
+
+// Cap returns the capacity.
+func (b *BlockingRingBuffer) Cap() int {
+	return b.rb.Cap()
+}
+
+// Write writes all the p into the buffer, it blocks until all the data is written
+// or the buffer is closed.
+func (b *BlockingRingBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	written := 0
+	for {
+		if b.err != nil {
+			return written, ErrRingBufferClosed
+		}
+		var n int
+		if b.rb.opts.overwrite {
+			n, _ = b.rb.Write(p)
+		} else {
+			n = b.rb.write(p)
+		}
+		if n > 0 {
+			b.readable.Broadcast()
+		}
+		written += n
+		p = p[n:]
+		if len(p) == 0 {
+			return written, nil
+		}
+		b.writable.Wait()
+	}
+}
+
+// Read reads the available data, it blocks until some data is available or the
+// buffer is closed.
+func (b *BlockingRingBuffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.rb.Len() == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		b.readable.Wait()
+	}
+	n, _ := b.rb.Read(p)
+	b.writable.Broadcast()
+	return n, nil
+}
+
+// Peek returns a copy of the next n bytes without advancing the reader, it
+// blocks until n bytes are available, if the buffer is closed before that, the
+// remaining data is returned with the close error. NOTE that n is limited by
+// the capacity.
+func (b *BlockingRingBuffer) Peek(n int) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n > b.rb.Cap() {
+		n = b.rb.Cap()
+	}
+	for b.rb.Len() < n && b.err == nil {
+		b.readable.Wait()
+	}
+	p, _ := b.rb.Peek(n)
+	p = append([]byte(nil), p...)
+	if len(p) < n {
+		return p, b.err
+	}
+	return p, nil
+}
+
+// Discard skips the next n bytes, it blocks until n bytes are discarded or the
+// buffer is closed.
+func (b *BlockingRingBuffer) Discard(n int) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	discarded := 0
+	for discarded < n {
+		if b.rb.Len() == 0 {
+			if b.err != nil {
+				return discarded, b.err
+			}
+			b.readable.Wait()
+			continue
+		}
+		m, _ := b.rb.Discard(n - discarded)
+		discarded += m
+		b.writable.Broadcast()
+	}
+	return discarded, nil
+}
+
+// Close closes the buffer, it is the same as CloseWithError(nil).
+func (b *BlockingRingBuffer) Close() error {
+	return b.CloseWithError(nil)
+}
+
+// CloseWithError closes the buffer, the Read returns the err after the remaining
+// data is drained, the err is io.EOF if nil.
+func (b *BlockingRingBuffer) CloseWithError(err error) error {
+	if err == nil {
+		err = io.EOF
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.err == nil {
+		b.err = err
+	}
+	b.readable.Broadcast()
+	b.writable.Broadcast()
+	return nil
+}
@@ -0,0 +1,147 @@
+package bytes
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingBuffer(t *testing.T) {
+	t.Parallel()
+
+	rb := NewRingBuffer(8)
+	n, err := rb.Write([]byte("abcdef"))
+	require.Nil(t, err)
+	require.Equal(t, 6, n)
+	require.Equal(t, 2, rb.Free())
+
+	buf := make([]byte, 4)
+	n, err = rb.Read(buf)
+	require.Nil(t, err)
+	require.Equal(t, "abcd", string(buf[:n]))
+
+	n, err = rb.Write([]byte("ghijklmn"))
+	require.Equal(t, ErrRingBufferFull, err)
+	require.Equal(t, 6, n)
+	require.Equal(t, 8, rb.Len())
+	first, second := rb.ReadableSlices()
+	require.Equal(t, "efgh", string(first))
+	require.Equal(t, "ijkl", string(second))
+	require.Equal(t, ErrRingBufferFull, rb.WriteByte('x'))
+
+	p, err := rb.Peek(6)
+	require.Nil(t, err)
+	require.Equal(t, "efghij", string(p))
+	n, err = rb.Discard(3)
+	require.Nil(t, err)
+	require.Equal(t, 3, n)
+	c, err := rb.ReadByte()
+	require.Nil(t, err)
+	require.Equal(t, byte('h'), c)
+	p, err = rb.Peek(10)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, "ijkl", string(p))
+
+	data, err := ioutil.ReadAll(rb)
+	require.Nil(t, err)
+	require.Equal(t, "ijkl", string(data))
+	_, err = rb.ReadByte()
+	require.Equal(t, io.EOF, err)
+	n, err = rb.Discard(1)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 0, n)
+}
+
+func TestRingBufferWritableSlices(t *testing.T) {
+	t.Parallel()
+
+	rb := NewRingBuffer(8)
+	_, _ = rb.Write([]byte("abcdef"))
+	_, _ = rb.Discard(4)
+	first, second := rb.WritableSlices()
+	require.Len(t, first, 2)
+	require.Len(t, second, 4)
+	copy(first, "gh")
+	copy(second, "ij")
+	rb.CommitWrite(4)
+	p, err := rb.Peek(rb.Len())
+	require.Nil(t, err)
+	require.Equal(t, "efghij", string(p))
+	require.Panics(t, func() { rb.CommitWrite(3) })
+}
+
+func TestRingBufferOverwrite(t *testing.T) {
+	t.Parallel()
+
+	rb := NewRingBuffer(4, WithRingBufferOverwrite())
+	n, err := rb.Write([]byte("abc"))
+	require.Nil(t, err)
+	require.Equal(t, 3, n)
+	n, err = rb.Write([]byte("de"))
+	require.Nil(t, err)
+	require.Equal(t, 2, n)
+	p, _ := rb.Peek(4)
+	require.Equal(t, "bcde", string(p))
+
+	_, _ = rb.Write([]byte("0123456789"))
+	p, _ = rb.Peek(4)
+	require.Equal(t, "6789", string(p))
+	require.Nil(t, rb.WriteByte('x'))
+	p, _ = rb.Peek(4)
+	require.Equal(t, "789x", string(p))
+}
+
+func TestBlockingRingBuffer(t *testing.T) {
+	t.Parallel()
+
+	b := NewBlockingRingBuffer(4)
+	data := strings.Repeat("0123456789", 100)
+	go func() {
+		n, err := b.Write([]byte(data))
+		if err == nil && n == len(data) {
+			_ = b.Close()
+		}
+	}()
+	p, err := b.Peek(3)
+	require.Nil(t, err)
+	require.Equal(t, "012", string(p))
+	n, err := b.Discard(2)
+	require.Nil(t, err)
+	require.Equal(t, 2, n)
+	read, err := ioutil.ReadAll(b)
+	require.Nil(t, err)
+	require.Equal(t, data[2:], string(read))
+
+	_, err = b.Write([]byte("x"))
+	require.Equal(t, ErrRingBufferClosed, err)
+	p, err = b.Peek(1)
+	require.Equal(t, io.EOF, err)
+	require.Len(t, p, 0)
+	_, err = b.Discard(1)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestBlockingRingBufferClose(t *testing.T) {
+	t.Parallel()
+
+	b := NewBlockingRingBuffer(4)
+	_, _ = b.Write([]byte("ab"))
+	errc := make(chan error, 1)
+	go func() {
+		_, err := b.Write([]byte("cdefg"))
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	expected := errors.New("aborted")
+	require.Nil(t, b.CloseWithError(expected))
+	require.Equal(t, ErrRingBufferClosed, <-errc)
+
+	read, err := ioutil.ReadAll(b)
+	require.Equal(t, expected, err)
+	require.Equal(t, "abcd", string(read))
+}
@@ -0,0 +1,272 @@
+package bytes
+
+import (
+	"io"
+	"net"
+)
+
+// SegmentedBuffer is a buffer made of a list of segments from a SegmentsPool,
+// it grows by appending segments instead of copying, so it is suitable for
+// building large data. The consumed segments are returned to the pool, and
+// Reset returns all of them.
+//
+// NOTE that the slices returned by Bytes and Peek are only valid until the next
+// modification of the buffer.
+type SegmentedBuffer struct {
+	pool        *SegmentsPool
+	segmentSize int
+	segments    [][]byte // The len of a segment is the end of its data.
+	off         int      // The read offset in the first segment.
+	size        int
+}
+
+// NewSegmentedBuffer creates a SegmentedBuffer which allocates segments with
+// at least segmentSize bytes from the pool.
+func NewSegmentedBuffer(pool *SegmentsPool, segmentSize int) *SegmentedBuffer {
+	if segmentSize < 1 {
+		segmentSize = 1
+	}
+	return &SegmentedBuffer{pool: pool, segmentSize: segmentSize}
+}
+
+// Len returns the number of the unread bytes.
+func (b *SegmentedBuffer) Len() int {
+	return b.size
+}
+
+// Segments returns the number of segments.
+func (b *SegmentedBuffer) Segments() int {
+	return len(b.segments)
+}
+
+// Reset discards all the data and returns the segments to the pool.
+func (b *SegmentedBuffer) Reset() {
+	for i, seg := range b.segments {
+		b.pool.Put(seg)
+		b.segments[i] = nil
+	}
+	b.segments = b.segments[:0]
+	b.off = 0
+	b.size = 0
+}
+
+// tail returns the spare space of the last segment, a new segment is appended
+// if the last one is full.
+func (b *SegmentedBuffer) tail() []byte {
+	if n := len(b.segments); n > 0 {
+		if seg := b.segments[n-1]; len(seg) < cap(seg) {
+			return seg[len(seg):cap(seg)]
+		}
+	}
+	seg := b.pool.Get(b.segmentSize)
+	b.segments = append(b.segments, seg[:0])
+	return seg[:cap(seg)]
+}
+
+// grow extends the last segment by n bytes written into its spare space.
+func (b *SegmentedBuffer) grow(n int) {
+	last := len(b.segments) - 1
+	b.segments[last] = b.segments[last][:len(b.segments[last])+n]
+	b.size += n
+}
+
+// Write appends the p to the buffer, the err is always nil.
+func (b *SegmentedBuffer) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(b.tail(), p)
+		b.grow(n)
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// WriteString appends the s to the buffer, the err is always nil.
+func (b *SegmentedBuffer) WriteString(s string) (int, error) {
+	written := 0
+	for len(s) > 0 {
+		n := copy(b.tail(), s)
+		b.grow(n)
+		s = s[n:]
+		written += n
+	}
+	return written, nil
+}
+
+// WriteByte appends the byte c to the buffer, the err is always nil.
+func (b *SegmentedBuffer) WriteByte(c byte) error {
+	b.tail()[0] = c
+	b.grow(1)
+	return nil
+}
+
+// ReadFrom reads data from r until EOF and appends it to the buffer, the io.EOF
+// is not returned.
+func (b *SegmentedBuffer) ReadFrom(r io.Reader) (int64, error) {
+	var total int64
+	for {
+		n, err := r.Read(b.tail())
+		if n < 0 {
+			panic("libext-go/bytes: reader returned negative count from Read")
+		}
+		b.grow(n)
+		total += int64(n)
+		if err != nil {
+			b.trimTail()
+			if err == io.EOF {
+				err = nil
+			}
+			return total, err
+		}
+	}
+}
+
+// trimTail returns the last segment to the pool if it is empty.
+func (b *SegmentedBuffer) trimTail() {
+	last := len(b.segments) - 1
+	if last < 0 || len(b.segments[last]) > 0 {
+		return
+	}
+	b.pool.Put(b.segments[last])
+	b.segments[last] = nil
+	b.segments = b.segments[:last]
+}
+
+// WriteTo writes the data to w until the buffer is drained or an error occurs,
+// the segments are written by net.Buffers, so writev is used if w supports it.
+func (b *SegmentedBuffer) WriteTo(w io.Writer) (int64, error) {
+	if b.size == 0 {
+		return 0, nil
+	}
+	buffers := make(net.Buffers, 0, len(b.segments))
+	for i, seg := range b.segments {
+		if i == 0 {
+			seg = seg[b.off:]
+		}
+		if len(seg) > 0 {
+			buffers = append(buffers, seg)
+		}
+	}
+	n, err := buffers.WriteTo(w)
+	b.discard(int(n))
+	return n, err
+}
+
+// Read reads the next len(p) bytes from the buffer or until the buffer is drained,
+// the err is io.EOF if the buffer is empty.
+func (b *SegmentedBuffer) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if b.size == 0 {
+		return 0, io.EOF
+	}
+	read := 0
+	for len(p) > 0 && b.size > 0 {
+		n := copy(p, b.segments[0][b.off:])
+		p = p[n:]
+		read += n
+		b.discard(n)
+	}
+	return read, nil
+}
+
+// ReadByte reads and returns the next byte from the buffer, the err is io.EOF
+// if the buffer is empty.
+func (b *SegmentedBuffer) ReadByte() (byte, error) {
+	if b.size == 0 {
+		return 0, io.EOF
+	}
+	c := b.segments[0][b.off]
+	b.discard(1)
+	return c, nil
+}
+
+// Peek returns the next n bytes without advancing the reader, the data is copied
+// if it crosses the segment boundaries. If Peek returns fewer than n bytes, the
+// err is io.EOF.
+func (b *SegmentedBuffer) Peek(n int) ([]byte, error) {
+	var err error
+	if n > b.size {
+		n = b.size
+		err = io.EOF
+	}
+	if n <= 0 {
+		return nil, err
+	}
+	if first := b.segments[0][b.off:]; len(first) >= n {
+		return first[:n], err
+	}
+
+	p := make([]byte, 0, n)
+	for i := 0; len(p) < n; i++ {
+		seg := b.segments[i]
+		if i == 0 {
+			seg = seg[b.off:]
+		}
+		if remaining := n - len(p); len(seg) > remaining {
+			seg = seg[:remaining]
+		}
+		p = append(p, seg...)
+	}
+	return p, err
+}
+
+// Discard skips the next n bytes, the err is io.EOF if the buffer has fewer than
+// n bytes.
+func (b *SegmentedBuffer) Discard(n int) (int, error) {
+	var err error
+	if n > b.size {
+		n = b.size
+		err = io.EOF
+	}
+	if n <= 0 {
+		return 0, err
+	}
+	b.discard(n)
+	return n, err
+}
+
+// discard skips n(<= b.size) bytes and returns the consumed segments to the pool.
+func (b *SegmentedBuffer) discard(n int) {
+	b.size -= n
+	for n > 0 {
+		seg := b.segments[0]
+		remaining := len(seg) - b.off
+		if n < remaining {
+			b.off += n
+			return
+		}
+		n -= remaining
+		b.pool.Put(seg)
+		b.segments[0] = nil
+		b.segments = b.segments[1:]
+		b.off = 0
+	}
+}
+
+// Bytes returns the unread data, the segments are flattened into one segment on
+// demand if there are more than one segments.
+func (b *SegmentedBuffer) Bytes() []byte {
+	if b.size == 0 {
+		return nil
+	}
+	if len(b.segments) == 1 {
+		return b.segments[0][b.off:]
+	}
+
+	flat := b.pool.Get(b.size)[:0]
+	for i, seg := range b.segments {
+		if i == 0 {
+			flat = append(flat, seg[b.off:]...)
+		} else {
+			flat = append(flat, seg...)
+		}
+		b.pool.Put(seg)
+		b.segments[i] = nil
+	}
+	b.segments = append(b.segments[:0], flat)
+	b.off = 0
+	return flat
+}
@@ -0,0 +1,130 @@
+package bytes
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestSegmentedBuffer() (*SegmentedBuffer, *SegmentsPool) {
+	p := NewSegmentsPool(SegmentsPoolSizesFrom([]int{4, 64}), WithSegmentsPoolStats())
+	return NewSegmentedBuffer(p, 4), p
+}
+
+func TestSegmentedBufferWriteRead(t *testing.T) {
+	t.Parallel()
+
+	b, _ := newTestSegmentedBuffer()
+	n, err := b.Write([]byte("hello"))
+	require.Nil(t, err)
+	require.Equal(t, 5, n)
+	_, _ = b.WriteString(" world")
+	require.Nil(t, b.WriteByte('!'))
+	require.Equal(t, 12, b.Len())
+	require.Equal(t, 3, b.Segments())
+
+	c, err := b.ReadByte()
+	require.Nil(t, err)
+	require.Equal(t, byte('h'), c)
+	buf := make([]byte, 5)
+	n, err = b.Read(buf)
+	require.Nil(t, err)
+	require.Equal(t, "ello ", string(buf[:n]))
+	require.Equal(t, 2, b.Segments())
+
+	data, err := ioutil.ReadAll(b)
+	require.Nil(t, err)
+	require.Equal(t, "world!", string(data))
+	require.Equal(t, 0, b.Len())
+	_, err = b.ReadByte()
+	require.Equal(t, io.EOF, err)
+	_, err = b.Read(buf)
+	require.Equal(t, io.EOF, err)
+}
+
+func TestSegmentedBufferPeekDiscard(t *testing.T) {
+	t.Parallel()
+
+	b, _ := newTestSegmentedBuffer()
+	_, _ = b.WriteString("0123456789")
+
+	p, err := b.Peek(3)
+	require.Nil(t, err)
+	require.Equal(t, "012", string(p))
+	p, err = b.Peek(9)
+	require.Nil(t, err)
+	require.Equal(t, "012345678", string(p))
+
+	n, err := b.Discard(5)
+	require.Nil(t, err)
+	require.Equal(t, 5, n)
+	p, err = b.Peek(4)
+	require.Nil(t, err)
+	require.Equal(t, "5678", string(p))
+	p, err = b.Peek(8)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, "56789", string(p))
+
+	n, err = b.Discard(8)
+	require.Equal(t, io.EOF, err)
+	require.Equal(t, 5, n)
+	require.Equal(t, 0, b.Len())
+	p, err = b.Peek(1)
+	require.Equal(t, io.EOF, err)
+	require.Nil(t, p)
+}
+
+func TestSegmentedBufferBytes(t *testing.T) {
+	t.Parallel()
+
+	b, p := newTestSegmentedBuffer()
+	require.Nil(t, b.Bytes())
+	_, _ = b.WriteString("abc")
+	require.Equal(t, "abc", string(b.Bytes()))
+
+	_, _ = b.WriteString("defghij")
+	_, _ = b.Discard(1)
+	require.Equal(t, 3, b.Segments())
+	require.Equal(t, "bcdefghij", string(b.Bytes()))
+	require.Equal(t, 1, b.Segments())
+	require.Equal(t, uint64(3), p.Stats().Classes[0].Puts)
+
+	_, _ = b.WriteString("k")
+	require.Equal(t, "bcdefghijk", string(b.Bytes()))
+	b.Reset()
+	require.Equal(t, 0, b.Len())
+	require.Equal(t, 0, b.Segments())
+	require.Equal(t, uint64(1), p.Stats().Classes[1].Puts)
+}
+
+func TestSegmentedBufferReadFromWriteTo(t *testing.T) {
+	t.Parallel()
+
+	b, p := newTestSegmentedBuffer()
+	data := strings.Repeat("0123456789", 10)
+	n, err := b.ReadFrom(strings.NewReader(data))
+	require.Nil(t, err)
+	require.Equal(t, int64(len(data)), n)
+	require.Equal(t, len(data), b.Len())
+	_, _ = b.Discard(2)
+
+	w := &bytes.Buffer{}
+	n, err = b.WriteTo(w)
+	require.Nil(t, err)
+	require.Equal(t, int64(len(data)-2), n)
+	require.Equal(t, data[2:], w.String())
+	require.Equal(t, 0, b.Len())
+
+	stats := p.Stats()
+	require.Equal(t, stats.Classes[0].Gets, stats.Classes[0].Puts)
+
+	var _ io.Reader = b
+	var _ io.Writer = b
+	var _ io.WriterTo = b
+	var _ io.ReaderFrom = b
+	var _ io.ByteReader = b
+}
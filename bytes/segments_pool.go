@@ -4,51 +4,351 @@ import (
 	"math"
 	"sort"
 	"sync"
+
+	"go.uber.org/atomic"
 )
 
-// SegmentsPool manages variable sized byte slices by multiple sync.Pool.
-type SegmentsPool struct {
-	sizes SegmentsPoolSizes
-	pools []sync.Pool
+type (
+	SegmentsPoolOptions struct {
+		stats        bool
+		debug        bool
+		leakDetector *LeakDetector
+	}
+	WithSegmentsPoolOption func(opts *SegmentsPoolOptions)
+)
+
+// WithSegmentsPoolStats enables the statistics, see SegmentsPool.Stats.
+func WithSegmentsPoolStats() WithSegmentsPoolOption {
+	return func(opts *SegmentsPoolOptions) {
+		opts.stats = true
+	}
+}
+
+// WithSegmentsPoolDebug enables the debug mode, which panics on double-Put and
+// use-after-Put. The returned slices are poisoned by Put and verified by Get, so
+// the writes after Put are detected by the next Get of the same slice.
+//
+// NOTE that the slices are kept in free lists instead of sync.Pool, they are never
+// released to GC, so it is only meant for testing.
+func WithSegmentsPoolDebug() WithSegmentsPoolOption {
+	return func(opts *SegmentsPoolOptions) {
+		opts.debug = true
+	}
+}
+
+// WithSegmentsPoolLeakDetector tracks the RefBuffers returned by GetRef, see
+// LeakDetector.
+func WithSegmentsPoolLeakDetector(detector *LeakDetector) WithSegmentsPoolOption {
+	return func(opts *SegmentsPoolOptions) {
+		opts.leakDetector = detector
+	}
+}
+
+func makeSegmentsPoolOptions(opts ...WithSegmentsPoolOption) SegmentsPoolOptions {
+	var poolOpts SegmentsPoolOptions
+	for _, opt := range opts {
+		opt(&poolOpts)
+	}
+	return poolOpts
+}
+
+// SegmentsPoolClassStats is the statistics of a size class.
+type SegmentsPoolClassStats struct {
+	Size int
+	// Gets is the number of Get served by this class.
+	Gets uint64
+	// Puts is the number of Put accepted by this class.
+	Puts uint64
+	// News is the number of slices allocated since the class is empty,
+	// so the hits is Gets minus News.
+	News uint64
+}
+
+// SegmentsPoolStats is the snapshot of the statistics of a SegmentsPool.
+type SegmentsPoolStats struct {
+	Classes []SegmentsPoolClassStats
+	// Misses is the number of Get which falls back to make since the size
+	// exceeds the largest class.
+	Misses uint64
+	// Discards is the number of Put which is discarded since the capacity
+	// is less than the smallest class or greater than the largest class.
+	Discards uint64
+}
+
+// NOTE that the 64-bit counters must be 8-byte aligned on 32-bit platforms,
+// they are placed first and the struct is padded since it is used in slices.
+type segmentsPoolClassCounters struct {
+	gets atomic.Uint64
+	puts atomic.Uint64
+	news atomic.Uint64
+	size int
+	_    [4]byte
+}
+
+type segmentsPoolCounters struct {
+	misses   atomic.Uint64
+	discards atomic.Uint64
 }
 
-// NewSegmentsPool creates a new SegmentsPool from given sizes.
-func NewSegmentsPool(sizes SegmentsPoolSizes) *SegmentsPool {
-	p := &SegmentsPool{sizes: sizes}
+const segmentsPoolPoison = 0xde
+
+// segmentsPoolDebugger replaces the sync.Pool in debug mode.
+type segmentsPoolDebugger struct {
+	mu     sync.Mutex
+	free   [][][]byte
+	pooled map[*byte]struct{}
+}
+
+func (d *segmentsPoolDebugger) get(index int) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	free := d.free[index]
+	if len(free) == 0 {
+		return nil, false
+	}
+	b := free[len(free)-1]
+	free[len(free)-1] = nil
+	d.free[index] = free[:len(free)-1]
+	delete(d.pooled, &b[0])
+	for _, c := range b {
+		if c != segmentsPoolPoison {
+			panic("libext-go/bytes: segment modified after Put")
+		}
+	}
+	return b, true
+}
+
+func (d *segmentsPoolDebugger) put(index int, b []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, ok := d.pooled[&b[0]]; ok {
+		panic("libext-go/bytes: segment Put twice")
+	}
+	d.pooled[&b[0]] = struct{}{}
+	for i := range b {
+		b[i] = segmentsPoolPoison
+	}
+	d.free[index] = append(d.free[index], b)
+}
+
+// segmentsPoolState is the set of pools built from a generation of sizes.
+type segmentsPoolState struct {
+	gen        uint64
+	sizes      SegmentsPoolSizes
+	classSizes []int
+	pools      []sync.Pool
+	classes    []segmentsPoolClassCounters // Nil if the statistics is disabled.
+	debugger   *segmentsPoolDebugger       // Nil if the debug mode is disabled.
+}
+
+func newSegmentsPoolState(sizes SegmentsPoolSizes, gen uint64, poolOpts SegmentsPoolOptions) *segmentsPoolState {
+	st := &segmentsPoolState{gen: gen, sizes: sizes}
 	sizes.Iterate(func(size int) bool {
-		p.pools = append(p.pools, sync.Pool{ // DO NOT copy it.
-			New: func() interface{} {
-				return make([]byte, size, size)
-			},
-		})
+		st.classSizes = append(st.classSizes, size)
 		return true
 	})
+	if poolOpts.stats {
+		st.classes = make([]segmentsPoolClassCounters, len(st.classSizes))
+		for i, size := range st.classSizes {
+			st.classes[i].size = size
+		}
+	}
+	if poolOpts.debug {
+		st.debugger = &segmentsPoolDebugger{
+			free:   make([][][]byte, len(st.classSizes)),
+			pooled: make(map[*byte]struct{}),
+		}
+	}
+	st.pools = make([]sync.Pool, len(st.classSizes))
+	for i, size := range st.classSizes {
+		index, size := i, size
+		st.pools[i].New = func() interface{} {
+			return st.newSegment(index, size)
+		}
+	}
+	return st
+}
+
+func (st *segmentsPoolState) newSegment(index, size int) []byte {
+	if st.classes != nil {
+		st.classes[index].news.Inc()
+	}
+	return make([]byte, size, size)
+}
+
+// classIndex returns the index of the class which a slice with the given capacity
+// can be pooled into, see floorClassIndex.
+func (st *segmentsPoolState) classIndex(capacity int) (int, bool) {
+	return floorClassIndex(st.sizes, st.classSizes, capacity)
+}
+
+// floorClassIndex returns the index of the class of the same size as capacity, or
+// the next lower class, the classSizes are the sizes iterated from sizes. It fails
+// if the capacity is less than the smallest class or greater than the largest class.
+func floorClassIndex(sizes SegmentsPoolSizes, classSizes []int, capacity int) (int, bool) {
+	index, ok := sizes.Index(capacity)
+	if !ok {
+		return 0, false
+	}
+	if classSizes[index] == capacity {
+		return index, true
+	}
+	if index == 0 || classSizes[index-1] == 0 {
+		return 0, false
+	}
+	return index - 1, true
+}
+
+func (st *segmentsPoolState) get(index int) []byte {
+	if st.debugger == nil {
+		return st.pools[index].Get().([]byte)
+	}
+	if b, ok := st.debugger.get(index); ok {
+		return b
+	}
+	return st.newSegment(index, st.classSizes[index])
+}
+
+func (st *segmentsPoolState) put(index int, b []byte) {
+	size := st.classSizes[index]
+	b = b[:size:size]
+	if st.debugger == nil {
+		st.pools[index].Put(b) //nolint:staticcheck
+		return
+	}
+	st.debugger.put(index, b)
+}
+
+// SegmentsPool manages variable sized byte slices by multiple sync.Pool.
+type SegmentsPool struct {
+	opts     SegmentsPoolOptions
+	adaptive *AdaptiveSegmentsPoolSizes // Nil if the sizes is not adaptive.
+	stats    *segmentsPoolCounters      // Nil if disabled.
+
+	mu    sync.Mutex // Guards the swapping of state.
+	state atomic.Value
+}
+
+// NewSegmentsPool creates a new SegmentsPool from given sizes. If the sizes is
+// an *AdaptiveSegmentsPoolSizes, the requested sizes are observed and the pools
+// are rebuilt once the size classes are recomputed.
+func NewSegmentsPool(sizes SegmentsPoolSizes, opts ...WithSegmentsPoolOption) *SegmentsPool {
+	poolOpts := makeSegmentsPoolOptions(opts...)
+	p := &SegmentsPool{opts: poolOpts}
+	if poolOpts.stats {
+		p.stats = &segmentsPoolCounters{}
+	}
+	var gen uint64
+	if adaptive, ok := sizes.(*AdaptiveSegmentsPoolSizes); ok {
+		p.adaptive = adaptive
+		sizes, gen = adaptive.current()
+	}
+	p.state.Store(newSegmentsPoolState(sizes, gen, poolOpts))
 	return p
 }
 
+func (p *SegmentsPool) loadState() *segmentsPoolState {
+	st := p.state.Load().(*segmentsPoolState)
+	if p.adaptive == nil {
+		return st
+	}
+	if _, gen := p.adaptive.current(); gen == st.gen {
+		return st
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	st = p.state.Load().(*segmentsPoolState)
+	sizes, gen := p.adaptive.current()
+	if gen != st.gen {
+		// The slices in the old pools are left to GC.
+		st = newSegmentsPoolState(sizes, gen, p.opts)
+		p.state.Store(st)
+	}
+	return st
+}
+
 // Get returns a byte slice by given size, the returned slice may bigger than size.
 func (p *SegmentsPool) Get(size int) []byte {
 	if size <= 0 {
 		return nil
 	}
+	if p.adaptive != nil {
+		p.adaptive.Observe(size)
+	}
 
-	index, ok := p.sizes.Index(size)
+	st := p.loadState()
+	index, ok := st.sizes.Index(size)
 	if ok {
-		return p.pools[index].Get().([]byte)
+		if st.classes != nil {
+			st.classes[index].gets.Inc()
+		}
+		return st.get(index)
+	}
+	if p.stats != nil {
+		p.stats.misses.Inc()
 	}
 	return make([]byte, size, size)
 }
 
-// Put puts the byte slice back into pool.
+// capacityOf returns the capacity of the slice that Get returns by given size.
+func (p *SegmentsPool) capacityOf(size int) int {
+	st := p.loadState()
+	if index, ok := st.sizes.Index(size); ok {
+		return st.classSizes[index]
+	}
+	return size
+}
+
+// Put puts the byte slice back into pool. The slice is pooled into the class of
+// the same size as its capacity, or resliced into the next lower class, so Get
+// always returns a slice with the full size of the class. It is discarded if the
+// capacity is less than the smallest class or greater than the largest class.
 func (p *SegmentsPool) Put(b []byte) {
 	capacity := cap(b)
 	if capacity == 0 {
 		return
 	}
 
-	if index, ok := p.sizes.Index(capacity); ok {
-		p.pools[index].Put(b) //nolint:staticcheck
+	st := p.loadState()
+	index, ok := st.classIndex(capacity)
+	if !ok {
+		if p.stats != nil {
+			p.stats.discards.Inc()
+		}
+		return
+	}
+	if st.classes != nil {
+		st.classes[index].puts.Inc()
+	}
+	st.put(index, b)
+}
+
+// Stats returns the snapshot of the statistics, it is empty if the statistics
+// is not enabled by WithSegmentsPoolStats. The statistics of classes are reset
+// once the adaptive size classes are recomputed.
+func (p *SegmentsPool) Stats() SegmentsPoolStats {
+	if p.stats == nil {
+		return SegmentsPoolStats{}
+	}
+	st := p.loadState()
+	stats := SegmentsPoolStats{
+		Classes:  make([]SegmentsPoolClassStats, 0, len(st.classes)),
+		Misses:   p.stats.misses.Load(),
+		Discards: p.stats.discards.Load(),
+	}
+	for i := range st.classes {
+		c := &st.classes[i]
+		stats.Classes = append(stats.Classes, SegmentsPoolClassStats{
+			Size: c.size,
+			Gets: c.gets.Load(),
+			Puts: c.puts.Load(),
+			News: c.news.Load(),
+		})
 	}
+	return stats
 }
 
 // SegmentsPoolSizes represents a list of sizes.
@@ -0,0 +1,256 @@
+package bytes
+
+import (
+	"math"
+	"math/bits"
+	"sync"
+
+	"go.uber.org/atomic"
+)
+
+const (
+	defaultAdaptiveMaxClasses        = 16
+	defaultAdaptiveMaxSize           = 1 << 20
+	defaultAdaptiveRecomputeInterval = 10000
+
+	// The histogram is log-linear: sizes in (2^(e-1), 2^e] are split into
+	// 8 buckets, so the waste introduced by the bucketing is at most 12.5%.
+	histogramSubBucketBits = 3
+	histogramSubBuckets    = 1 << histogramSubBucketBits
+)
+
+type (
+	AdaptiveSizesOptions struct {
+		maxClasses        int
+		maxSize           int
+		recomputeInterval uint64
+	}
+	WithAdaptiveSizesOption func(opts *AdaptiveSizesOptions)
+)
+
+// WithAdaptiveMaxClasses sets the max number of size classes.
+func WithAdaptiveMaxClasses(n int) WithAdaptiveSizesOption {
+	return func(opts *AdaptiveSizesOptions) {
+		if n < 1 {
+			n = 1
+		}
+		opts.maxClasses = n
+	}
+}
+
+// WithAdaptiveMaxSize sets the max size to be pooled, the larger sizes are not
+// observed. The largest size class may be rounded up a little bit.
+func WithAdaptiveMaxSize(size int) WithAdaptiveSizesOption {
+	return func(opts *AdaptiveSizesOptions) {
+		if size < 1 {
+			size = 1
+		}
+		opts.maxSize = size
+	}
+}
+
+// WithAdaptiveRecomputeInterval recomputes the size classes in the background
+// every n observations, zero means the size classes are only recomputed by calling Recompute.
+func WithAdaptiveRecomputeInterval(n uint64) WithAdaptiveSizesOption {
+	return func(opts *AdaptiveSizesOptions) {
+		opts.recomputeInterval = n
+	}
+}
+
+var _defaultAdaptiveSizesOptions = []WithAdaptiveSizesOption{
+	WithAdaptiveMaxClasses(defaultAdaptiveMaxClasses),
+	WithAdaptiveMaxSize(defaultAdaptiveMaxSize),
+	WithAdaptiveRecomputeInterval(defaultAdaptiveRecomputeInterval),
+}
+
+func makeAdaptiveSizesOptions(opts ...WithAdaptiveSizesOption) AdaptiveSizesOptions {
+	var sizesOpts AdaptiveSizesOptions
+	for _, opt := range _defaultAdaptiveSizesOptions {
+		opt(&sizesOpts)
+	}
+	for _, opt := range opts {
+		opt(&sizesOpts)
+	}
+	return sizesOpts
+}
+
+type adaptiveSizesState struct {
+	gen   uint64
+	sizes sortedSegmentsPoolSizes
+}
+
+// AdaptiveSegmentsPoolSizes is a SegmentsPoolSizes which learns the size classes
+// from the requested sizes. It records a histogram of the observed sizes and
+// recomputes the size classes periodically to minimize the wasted bytes, the
+// histogram decays by half after each recomputation to follow the changes.
+//
+// The SegmentsPool created from it observes the sizes of Get automatically,
+// and rebuilds its pools once the size classes are changed.
+type AdaptiveSegmentsPoolSizes struct {
+	observed    atomic.Uint64 // The first field to be 8-byte aligned on 32-bit platforms.
+	recomputing atomic.Bool
+	opts        AdaptiveSizesOptions
+	counts      []atomic.Uint64
+
+	mu    sync.Mutex // Serializes the recomputation.
+	state atomic.Value
+}
+
+// NewAdaptiveSegmentsPoolSizes creates an AdaptiveSegmentsPoolSizes, the initial
+// sizes are used before the first recomputation. NOTE that it will panic if the
+// initial sizes contain negative value.
+func NewAdaptiveSegmentsPoolSizes(initial []int, opts ...WithAdaptiveSizesOption) *AdaptiveSegmentsPoolSizes {
+	sizesOpts := makeAdaptiveSizesOptions(opts...)
+	sizes := SegmentsPoolSizesFrom(append([]int(nil), initial...)).(sortedSegmentsPoolSizes)
+	a := &AdaptiveSegmentsPoolSizes{
+		opts:   sizesOpts,
+		counts: make([]atomic.Uint64, histogramBucketIndex(sizesOpts.maxSize)+1),
+	}
+	a.state.Store(&adaptiveSizesState{sizes: sizes})
+	return a
+}
+
+func (a *AdaptiveSegmentsPoolSizes) current() (SegmentsPoolSizes, uint64) {
+	st := a.state.Load().(*adaptiveSizesState)
+	return st.sizes, st.gen
+}
+
+// Iterate iterates over the current sizes.
+func (a *AdaptiveSegmentsPoolSizes) Iterate(sizeIterator func(int) bool) {
+	sizes, _ := a.current()
+	sizes.Iterate(sizeIterator)
+}
+
+// Index returns the index of the given size in the current sizes.
+func (a *AdaptiveSegmentsPoolSizes) Index(size int) (int, bool) {
+	sizes, _ := a.current()
+	return sizes.Index(size)
+}
+
+// Observe records a requested size, it may trigger the recomputation in the
+// background, at most one recomputation is running at a time.
+func (a *AdaptiveSegmentsPoolSizes) Observe(size int) {
+	if size <= 0 || size > a.opts.maxSize {
+		return
+	}
+	a.counts[histogramBucketIndex(size)].Inc()
+	if n := a.observed.Inc(); a.opts.recomputeInterval > 0 && n%a.opts.recomputeInterval == 0 {
+		if a.recomputing.CAS(false, true) {
+			go func() {
+				defer a.recomputing.Store(false)
+				a.Recompute()
+			}()
+		}
+	}
+}
+
+// Recompute recomputes the size classes from the histogram, it reports whether
+// the size classes are changed.
+func (a *AdaptiveSegmentsPoolSizes) Recompute() bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var uppers []int
+	var counts []uint64
+	for i := range a.counts {
+		count := a.counts[i].Load()
+		if count == 0 {
+			continue
+		}
+		a.counts[i].Sub(count / 2) // Decay.
+		uppers = append(uppers, histogramBucketUpper(i))
+		counts = append(counts, count)
+	}
+	if len(uppers) == 0 {
+		return false
+	}
+
+	sizes := sortedSegmentsPoolSizes(optimalSizeClasses(uppers, counts, a.opts.maxClasses))
+	st := a.state.Load().(*adaptiveSizesState)
+	if equalInts(st.sizes, sizes) {
+		return false
+	}
+	a.state.Store(&adaptiveSizesState{gen: st.gen + 1, sizes: sizes})
+	return true
+}
+
+func histogramBucketIndex(size int) int {
+	if size <= histogramSubBuckets {
+		return size - 1
+	}
+	e := bits.Len(uint(size - 1)) // 2^(e-1) < size <= 2^e
+	shift := uint(e - 1 - histogramSubBucketBits)
+	base := 1 << uint(e-1)
+	sub := (size - base + (1 << shift) - 1) >> shift // In [1, histogramSubBuckets].
+	return histogramSubBuckets + (e-1-histogramSubBucketBits)*histogramSubBuckets + sub - 1
+}
+
+func histogramBucketUpper(index int) int {
+	if index < histogramSubBuckets {
+		return index + 1
+	}
+	index -= histogramSubBuckets
+	e := index/histogramSubBuckets + histogramSubBucketBits + 1
+	sub := index%histogramSubBuckets + 1
+	return 1<<uint(e-1) + sub<<uint(e-1-histogramSubBucketBits)
+}
+
+// optimalSizeClasses picks at most k sizes from the sorted uppers to minimize
+// the wasted bytes: sum(count * (class - upper)), the largest upper is always
+// picked to cover all the sizes.
+func optimalSizeClasses(uppers []int, counts []uint64, k int) []int {
+	n := len(uppers)
+	if k > n {
+		k = n
+	}
+	prefixCounts := make([]float64, n+1)
+	prefixBytes := make([]float64, n+1)
+	for i := 0; i < n; i++ {
+		prefixCounts[i+1] = prefixCounts[i] + float64(counts[i])
+		prefixBytes[i+1] = prefixBytes[i] + float64(counts[i])*float64(uppers[i])
+	}
+	// waste returns the wasted bytes if the sizes in [a, b] are served by the uppers[b].
+	waste := func(a, b int) float64 {
+		return float64(uppers[b])*(prefixCounts[b+1]-prefixCounts[a]) - (prefixBytes[b+1] - prefixBytes[a])
+	}
+
+	// costs[m][b]: the min waste of serving [0, b] by m+1 classes with the largest one uppers[b].
+	costs := make([][]float64, k)
+	prevs := make([][]int, k)
+	for m := 0; m < k; m++ {
+		costs[m] = make([]float64, n)
+		prevs[m] = make([]int, n)
+		for b := 0; b < n; b++ {
+			if m == 0 {
+				costs[m][b] = waste(0, b)
+				continue
+			}
+			costs[m][b] = math.Inf(1)
+			for a := m - 1; a < b; a++ {
+				if cost := costs[m-1][a] + waste(a+1, b); cost < costs[m][b] {
+					costs[m][b] = cost
+					prevs[m][b] = a
+				}
+			}
+		}
+	}
+
+	sizes := make([]int, k)
+	for m, b := k-1, n-1; m >= 0; m-- {
+		sizes[m] = uppers[b]
+		b = prevs[m][b]
+	}
+	return sizes
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
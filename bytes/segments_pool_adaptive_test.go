@@ -0,0 +1,99 @@
+package bytes
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	t.Parallel()
+
+	prevIndex := -1
+	for size := 1; size <= 1<<16; size++ {
+		index := histogramBucketIndex(size)
+		require.True(t, index == prevIndex || index == prevIndex+1, "size: %d", size)
+		upper := histogramBucketUpper(index)
+		require.True(t, upper >= size && upper <= size+size/8+1, "size: %d, upper: %d", size, upper)
+		require.Equal(t, index, histogramBucketIndex(upper))
+		prevIndex = index
+	}
+	require.Equal(t, 104, histogramBucketUpper(histogramBucketIndex(100)))
+	require.Equal(t, 5120, histogramBucketUpper(histogramBucketIndex(5000)))
+}
+
+func TestOptimalSizeClasses(t *testing.T) {
+	t.Parallel()
+
+	uppers := []int{104, 1024, 5120}
+	counts := []uint64{1000, 1000, 10}
+	require.Equal(t, []int{5120}, optimalSizeClasses(uppers, counts, 1))
+	require.Equal(t, []int{1024, 5120}, optimalSizeClasses(uppers, counts, 2))
+	require.Equal(t, []int{104, 1024, 5120}, optimalSizeClasses(uppers, counts, 3))
+	require.Equal(t, []int{104, 1024, 5120}, optimalSizeClasses(uppers, counts, 8))
+	counts[0] = 100000
+	require.Equal(t, []int{104, 5120}, optimalSizeClasses(uppers, counts, 2))
+}
+
+func TestAdaptiveSegmentsPoolSizes(t *testing.T) {
+	t.Parallel()
+
+	sizes := NewAdaptiveSegmentsPoolSizes([]int{64}, WithAdaptiveMaxClasses(2), WithAdaptiveRecomputeInterval(100))
+	p := NewSegmentsPool(sizes, WithSegmentsPoolStats())
+	require.Equal(t, 64, cap(p.Get(10)))
+	for i := 0; i < 98; i++ {
+		b := p.Get(1000)
+		require.Equal(t, 1000, cap(b))
+		p.Put(b)
+	}
+	require.Equal(t, uint64(98), p.Stats().Misses)
+
+	// Recomputed in the background.
+	_ = p.Get(1000)
+	for i := 0; ; i++ {
+		if _, gen := sizes.current(); gen > 0 {
+			break
+		}
+		require.True(t, i < 1000, "not recomputed")
+		time.Sleep(time.Millisecond)
+	}
+	require.Equal(t, 1024, cap(p.Get(1000)))
+	require.Equal(t, 10, cap(p.Get(10)))
+	var classes []int
+	sizes.Iterate(func(size int) bool {
+		classes = append(classes, size)
+		return true
+	})
+	require.Equal(t, []int{10, 1024}, classes)
+	require.Len(t, p.Stats().Classes, 2)
+	require.False(t, sizes.Recompute())
+
+	sizes.Observe(1 << 30) // Ignored.
+	_, ok := sizes.Index(1 << 20)
+	require.False(t, ok)
+}
+
+func TestAdaptiveSegmentsPoolConcurrent(t *testing.T) {
+	t.Parallel()
+
+	sizes := NewAdaptiveSegmentsPoolSizes(nil, WithAdaptiveRecomputeInterval(64), WithAdaptiveMaxSize(1<<16))
+	p := NewSegmentsPool(sizes)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rnd := rand.New(rand.NewSource(seed))
+			for j := 0; j < 2000; j++ {
+				size := 1 + rnd.Intn(1<<16)
+				b := p.Get(size)
+				require.True(t, cap(b) >= size)
+				p.Put(b[:size])
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+}
@@ -1,6 +1,7 @@
 package bytes
 
 import (
+	"bytes"
 	"fmt"
 	"math"
 	"strconv"
@@ -162,3 +163,74 @@ func testSegmentsPoolConcurrent(t *testing.T, p *SegmentsPool, dataset []slicePo
 	}
 	wg.Wait()
 }
+
+func TestSegmentsPoolStats(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, SegmentsPoolStats{}, NewSegmentsPool(SegmentsPoolSizesFrom([]int{2, 4})).Stats())
+
+	p := NewSegmentsPool(SegmentsPoolSizesFrom([]int{2, 4}), WithSegmentsPoolStats())
+	for i := 0; i < 3; i++ {
+		p.Put(p.Get(1))
+	}
+	p.Put(p.Get(3))
+	p.Put(p.Get(5))
+	p.Put(make([]byte, 8))
+
+	stats := p.Stats()
+	require.Equal(t, uint64(1), stats.Misses)
+	require.Equal(t, uint64(2), stats.Discards)
+	require.Len(t, stats.Classes, 2)
+	for i, c := range []struct {
+		size int
+		gets uint64
+	}{{2, 3}, {4, 1}} {
+		class := stats.Classes[i]
+		require.Equal(t, c.size, class.Size)
+		require.Equal(t, c.gets, class.Gets)
+		require.Equal(t, c.gets, class.Puts)
+		require.True(t, class.News >= 1 && class.News <= class.Gets)
+	}
+}
+
+func TestSegmentsPoolPutExactClass(t *testing.T) {
+	t.Parallel()
+
+	p := NewSegmentsPool(SegmentsPoolSizesFrom([]int{64, 128}), WithSegmentsPoolDebug(), WithSegmentsPoolStats())
+	b := make([]byte, 10, 100)
+	p.Put(b)
+	require.Equal(t, 128, cap(p.Get(128)))
+	b2 := p.Get(64)
+	require.Equal(t, 64, len(b2))
+	require.Equal(t, 64, cap(b2))
+	require.True(t, &b[:1][0] == &b2[0])
+
+	p.Put(make([]byte, 32))
+	p.Put(make([]byte, 256))
+	require.Equal(t, uint64(2), p.Stats().Discards)
+
+	b3 := p.Get(100)
+	p.Put(b3[:1])
+	require.Equal(t, b3[:128], p.Get(128))
+}
+
+func TestSegmentsPoolDebug(t *testing.T) {
+	t.Parallel()
+
+	p := NewSegmentsPool(SegmentsPoolSizesFrom([]int{8, 16}), WithSegmentsPoolDebug())
+	b := p.Get(8)
+	copy(b, "abcdefgh")
+	p.Put(b)
+	require.Equal(t, bytes.Repeat([]byte{segmentsPoolPoison}, 8), b)
+	require.Panics(t, func() { p.Put(b) })
+	require.Panics(t, func() { p.Put(b[:0:8]) })
+
+	b = p.Get(8)
+	p.Put(b)
+	b[1] = 'x' // Use after Put.
+	require.Panics(t, func() { p.Get(8) })
+
+	b = p.Get(16)
+	p.Put(b)
+	require.NotPanics(t, func() { p.Put(p.Get(16)) })
+}
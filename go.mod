@@ -1,8 +1,13 @@
 module github.com/damnever/libext-go
 
-go 1.13
+go 1.18
 
 require (
 	github.com/stretchr/testify v1.3.0
 	go.uber.org/atomic v1.5.1
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
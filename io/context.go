@@ -0,0 +1,104 @@
+package io
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+var _aLongTimeAgo = time.Unix(1, 0) //nolint:gochecknoglobals
+
+type (
+	readDeadliner interface {
+		SetReadDeadline(t time.Time) error
+	}
+	writeDeadliner interface {
+		SetWriteDeadline(t time.Time) error
+	}
+)
+
+// ContextReader aborts the Read if the context is done and returns ctx.Err().
+//
+// If the underlying reader supports SetReadDeadline(e.g. net.Conn), the blocking
+// Read is interrupted by setting the read deadline in the past, and the deadline
+// is left as it is afterwards. A single watcher goroutine is armed on the first
+// Read and exits once the context is done, so cancel the context after use.
+// Otherwise, the context is checked before each Read without any goroutine, so
+// the blocking Read can not be interrupted.
+type ContextReader struct {
+	ctx     context.Context
+	r       io.Reader
+	watcher deadlineWatcher
+}
+
+// NewContextReader creates a ContextReader.
+func NewContextReader(ctx context.Context, r io.Reader) *ContextReader {
+	return &ContextReader{ctx: ctx, r: r}
+}
+
+func (r *ContextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	dr, ok := r.r.(readDeadliner)
+	if !ok || r.ctx.Done() == nil {
+		return r.r.Read(p)
+	}
+
+	r.watcher.arm(r.ctx, dr.SetReadDeadline)
+	n, err := r.r.Read(p)
+	if err != nil {
+		if ctxErr := r.ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+	}
+	return n, err
+}
+
+// ContextWriter aborts the Write if the context is done and returns ctx.Err(),
+// it is the same as ContextReader but uses SetWriteDeadline.
+type ContextWriter struct {
+	ctx     context.Context
+	w       io.Writer
+	watcher deadlineWatcher
+}
+
+// NewContextWriter creates a ContextWriter.
+func NewContextWriter(ctx context.Context, w io.Writer) *ContextWriter {
+	return &ContextWriter{ctx: ctx, w: w}
+}
+
+func (w *ContextWriter) Write(b []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, err
+	}
+	dw, ok := w.w.(writeDeadliner)
+	if !ok || w.ctx.Done() == nil {
+		return w.w.Write(b)
+	}
+
+	w.watcher.arm(w.ctx, dw.SetWriteDeadline)
+	n, err := w.w.Write(b)
+	if err != nil {
+		if ctxErr := w.ctx.Err(); ctxErr != nil {
+			err = ctxErr
+		}
+	}
+	return n, err
+}
+
+// deadlineWatcher sets the deadline in the past once the context is done, the
+// goroutine is started once per adapter, since the context never changes.
+type deadlineWatcher struct {
+	once sync.Once
+}
+
+func (w *deadlineWatcher) arm(ctx context.Context, setDeadline func(time.Time) error) {
+	w.once.Do(func() {
+		go func() {
+			<-ctx.Done()
+			_ = setDeadline(_aLongTimeAgo)
+		}()
+	})
+}
@@ -0,0 +1,93 @@
+package io
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestContextReader(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewContextReader(ctx, c1)
+	go func() { _, _ = c2.Write([]byte("abc")) }()
+	buf := make([]byte, 8)
+	n, err := r.Read(buf)
+	require.Nil(t, err)
+	require.Equal(t, "abc", string(buf[:n]))
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err = r.Read(buf)
+	require.Equal(t, context.Canceled, err)
+	_, err = r.Read(buf)
+	require.Equal(t, context.Canceled, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.Nil(t, c1.SetReadDeadline(time.Time{}))
+	_, err = NewContextReader(ctx, c1).Read(buf)
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	// Without deadline support.
+	r = NewContextReader(context.Background(), bytes.NewReader([]byte("xyz")))
+	n, err = r.Read(buf)
+	require.Nil(t, err)
+	require.Equal(t, "xyz", string(buf[:n]))
+	_, err = r.Read(buf)
+	require.Equal(t, io.EOF, err)
+	_, err = NewContextReader(ctx, bytes.NewReader([]byte("xyz"))).Read(buf)
+	require.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestContextWriter(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w := NewContextWriter(ctx, c1)
+	go func() { _, _ = c2.Read(make([]byte, 3)) }()
+	n, err := w.Write([]byte("abc"))
+	require.Nil(t, err)
+	require.Equal(t, 3, n)
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+	_, err = w.Write([]byte("blocked"))
+	require.Equal(t, context.Canceled, err)
+
+	buf := &bytes.Buffer{}
+	_, err = NewContextWriter(context.Background(), buf).Write([]byte("ok"))
+	require.Nil(t, err)
+	require.Equal(t, "ok", buf.String())
+	_, err = NewContextWriter(ctx, buf).Write([]byte("no"))
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestContextReaderSingleWatcher(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() { _, _ = io.Copy(c2, bytes.NewReader(make([]byte, 100))) }()
+	r := NewContextReader(ctx, c1)
+	buf := make([]byte, 1)
+	_, err := r.Read(buf)
+	require.Nil(t, err)
+	before := runtime.NumGoroutine()
+	for i := 0; i < 99; i++ {
+		_, err := r.Read(buf)
+		require.Nil(t, err)
+	}
+	require.True(t, runtime.NumGoroutine() <= before)
+}
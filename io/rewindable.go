@@ -8,6 +8,7 @@ import (
 // RewindableReader is a reader which can be rewind and reads from begin again.
 // It is not thread-safe.
 type RewindableReader struct {
+	src     io.Reader
 	r       io.Reader
 	buf     *bytes.Buffer
 	bufread int
@@ -28,6 +29,7 @@ func (rr *RewindableReader) Reset(r io.Reader) {
 	rr.rewind = false
 	rr.buf.Reset()
 	rr.bufread = 0
+	rr.src = r
 	rr.r = io.TeeReader(r, rr.buf)
 }
 
@@ -37,16 +39,28 @@ func (rr *RewindableReader) Rewind() {
 	rr.bufread = 0
 }
 
-// Read implements io.Reader. It always returns len(p) and a nil error, otherwise the error is not nil.
+// Read implements io.Reader. After rewinding, it reads the buffered data first
+// and returns without reading the underlying reader if any buffered data is read,
+// so it may return less than len(p) bytes with a nil error.
 func (rr *RewindableReader) Read(p []byte) (int, error) {
 	if rr.rewind && rr.buf.Len() > rr.bufread {
 		n := copy(p, rr.buf.Bytes()[rr.bufread:])
 		rr.bufread += n
-		if n == len(p) {
-			return n, nil
-		}
-		// Short.
-		p = p[n:]
+		return n, nil
 	}
-	return rr.r.Read(p)
+	n, err := rr.r.Read(p)
+	if rr.rewind {
+		rr.bufread += n // The data is also recorded.
+	}
+	return n, err
+}
+
+// Detach returns a reader which reads the unread buffered data first and then reads
+// from the underlying reader directly, the data will not be recorded anymore.
+// The RewindableReader should not be used after detaching unless it is reset.
+func (rr *RewindableReader) Detach() io.Reader {
+	if !rr.rewind || rr.buf.Len() <= rr.bufread {
+		return rr.src
+	}
+	return io.MultiReader(bytes.NewReader(rr.buf.Bytes()[rr.bufread:]), rr.src)
 }
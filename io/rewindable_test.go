@@ -2,6 +2,8 @@ package io
 
 import (
 	"bytes"
+	"io"
+	"io/ioutil"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -20,15 +22,77 @@ func TestRewindableReader(t *testing.T) {
 	for i := len(data) - 1; i >= 0; i-- {
 		r.Rewind()
 		buf := make([]byte, len(data)-i)
-		_, err := r.Read(buf)
+		_, err := io.ReadFull(r, buf)
 		require.Nil(t, err)
 		require.Equal(t, data[:len(data)-i], buf)
 	}
 	for i := 0; i < len(data); i++ {
 		r.Rewind()
 		buf := make([]byte, len(data)-i)
-		_, err := r.Read(buf)
+		_, err := io.ReadFull(r, buf)
 		require.Nil(t, err)
 		require.Equal(t, data[:len(data)-i], buf)
 	}
 }
+
+func TestRewindableReader_ShortRead(t *testing.T) {
+	r := NewRewindableReader(bytes.NewBuffer([]byte("hello world")))
+	buf := make([]byte, 5)
+	_, err := r.Read(buf)
+	require.Nil(t, err)
+
+	r.Rewind()
+	buf = make([]byte, 8)
+	n, err := r.Read(buf)
+	require.Nil(t, err)
+	require.Equal(t, 5, n)
+	require.Equal(t, "hello", string(buf[:n]))
+	n, err = r.Read(buf)
+	require.Nil(t, err)
+	require.Equal(t, 6, n)
+	require.Equal(t, " world", string(buf[:n]))
+
+	r.Rewind()
+	_, err = io.ReadFull(r, buf)
+	require.Nil(t, err)
+	require.Equal(t, "hello wo", string(buf))
+}
+
+func TestRewindableReader_Detach(t *testing.T) {
+	data := []byte("hello world")
+	r := NewRewindableReader(bytes.NewBuffer(data))
+	buf := make([]byte, 5)
+	_, err := r.Read(buf)
+	require.Nil(t, err)
+	r.Rewind()
+	_, err = r.Read(buf[:2])
+	require.Nil(t, err)
+
+	rest, err := ioutil.ReadAll(r.Detach())
+	require.Nil(t, err)
+	require.Equal(t, data[2:], rest)
+
+	r = NewRewindableReader(bytes.NewBuffer(data))
+	_, err = r.Read(buf)
+	require.Nil(t, err)
+	rest, err = ioutil.ReadAll(r.Detach())
+	require.Nil(t, err)
+	require.Equal(t, data[5:], rest)
+}
+
+func TestRewindableReader_SequentialReads(t *testing.T) {
+	data := []byte("hello world")
+	r := NewRewindableReader(bytes.NewBuffer(data))
+	r.Rewind()
+	for i := 0; i < 3; i++ {
+		actual := make([]byte, 0, len(data))
+		b := make([]byte, 1)
+		for j := 0; j < len(data); j++ {
+			_, err := r.Read(b)
+			require.Nil(t, err)
+			actual = append(actual, b[0])
+		}
+		require.Equal(t, data, actual)
+		r.Rewind()
+	}
+}
@@ -0,0 +1,161 @@
+package net
+
+import (
+	"net"
+
+	"go.uber.org/atomic"
+)
+
+type (
+	// AccessRules decides which remote addresses are allowed, a remote address is allowed
+	// if it is not in the Deny and it is in the Allow. The nil Allow allows all addresses,
+	// the nil Deny denies nothing. Addresses which are not IP based, e.g. Unix domain
+	// socket addresses, are only allowed if the Allow is nil.
+	//
+	// NOTE that the IPSet must not be modified after passing it to the AccessPolicy.
+	AccessRules struct {
+		Allow *IPSet
+		Deny  *IPSet
+	}
+
+	// AccessDecisionFunc is called on each access decision, it can be used for auditing.
+	AccessDecisionFunc func(addr net.Addr, allowed bool)
+
+	AccessPolicyOptions struct {
+		onDecision AccessDecisionFunc
+	}
+	WithAccessPolicyOption func(opts *AccessPolicyOptions)
+)
+
+// WithAccessDecisionCallback sets the callback which is called on each access decision.
+func WithAccessDecisionCallback(onDecision AccessDecisionFunc) WithAccessPolicyOption {
+	return func(opts *AccessPolicyOptions) {
+		opts.onDecision = onDecision
+	}
+}
+
+func makeAccessPolicyOptions(opts ...WithAccessPolicyOption) AccessPolicyOptions {
+	var policyOpts AccessPolicyOptions
+	for _, opt := range opts {
+		opt(&policyOpts)
+	}
+	return policyOpts
+}
+
+// AccessPolicy controls the access by remote addresses, the rules can be reloaded
+// at any time, it is safe for concurrent use.
+type AccessPolicy struct {
+	rules atomic.Value // AccessRules
+	opts  AccessPolicyOptions
+}
+
+// NewAccessPolicy creates a new AccessPolicy.
+func NewAccessPolicy(rules AccessRules, opts ...WithAccessPolicyOption) *AccessPolicy {
+	p := &AccessPolicy{opts: makeAccessPolicyOptions(opts...)}
+	p.rules.Store(rules)
+	return p
+}
+
+// Reload replaces the rules, the new rules take effect immediately.
+func (p *AccessPolicy) Reload(rules AccessRules) {
+	p.rules.Store(rules)
+}
+
+// Allowed reports whether the remote address is allowed.
+func (p *AccessPolicy) Allowed(addr net.Addr) bool {
+	rules := p.rules.Load().(AccessRules)
+	ip := addrIP(addr)
+
+	allowed := true
+	switch {
+	case ip == nil:
+		allowed = rules.Allow == nil
+	case rules.Deny != nil && rules.Deny.Contains(ip):
+		allowed = false
+	case rules.Allow != nil:
+		allowed = rules.Allow.Contains(ip)
+	}
+	if p.opts.onDecision != nil {
+		p.opts.onDecision(addr, allowed)
+	}
+	return allowed
+}
+
+func addrIP(addr net.Addr) net.IP {
+	switch v := addr.(type) {
+	case *net.TCPAddr:
+		if v == nil {
+			return nil
+		}
+		return v.IP
+	case *net.UDPAddr:
+		if v == nil {
+			return nil
+		}
+		return v.IP
+	case *net.IPAddr:
+		if v == nil {
+			return nil
+		}
+		return v.IP
+	case nil:
+		return nil
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
+
+type accessControlledListener struct {
+	net.Listener
+
+	policy *AccessPolicy
+}
+
+// NewAccessControlledListener wraps the listener, the connections which are not
+// allowed by the policy will be closed right after they are accepted.
+func NewAccessControlledListener(l net.Listener, policy *AccessPolicy) net.Listener {
+	return accessControlledListener{
+		Listener: l,
+		policy:   policy,
+	}
+}
+
+func (l accessControlledListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.policy.Allowed(conn.RemoteAddr()) {
+			return conn, nil
+		}
+		_ = conn.Close()
+	}
+}
+
+type accessControlledPacketConn struct {
+	net.PacketConn
+
+	policy *AccessPolicy
+}
+
+// NewAccessControlledPacketConn wraps the conn, the packets which are not
+// allowed by the policy will be dropped silently.
+func NewAccessControlledPacketConn(conn net.PacketConn, policy *AccessPolicy) net.PacketConn {
+	return accessControlledPacketConn{
+		PacketConn: conn,
+		policy:     policy,
+	}
+}
+
+func (c accessControlledPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil || c.policy.Allowed(addr) {
+			return n, addr, err
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package net
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	allow, err := ParseIPSet("10.0.0.0/8", "2001:db8::/32")
+	require.Nil(t, err)
+	deny, err := ParseIPSet("10.0.0.1")
+	require.Nil(t, err)
+
+	var decisions []bool
+	p := NewAccessPolicy(AccessRules{Allow: allow, Deny: deny},
+		WithAccessDecisionCallback(func(_ net.Addr, allowed bool) {
+			decisions = append(decisions, allowed)
+		}))
+	require.True(t, p.Allowed(&net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 80}))
+	require.False(t, p.Allowed(&net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 53}))
+	require.False(t, p.Allowed(&net.IPAddr{IP: net.ParseIP("192.168.0.1")}))
+	require.True(t, p.Allowed(&net.TCPAddr{IP: net.ParseIP("2001:db8::1")}))
+	require.False(t, p.Allowed(&net.UnixAddr{Name: "/tmp/x.sock", Net: "unix"}))
+	require.Equal(t, []bool{true, false, false, true, false}, decisions)
+
+	p.Reload(AccessRules{Deny: deny})
+	require.True(t, p.Allowed(&net.IPAddr{IP: net.ParseIP("192.168.0.1")}))
+	require.False(t, p.Allowed(&net.TCPAddr{IP: net.ParseIP("10.0.0.1")}))
+	require.True(t, p.Allowed(&net.UnixAddr{Name: "/tmp/x.sock", Net: "unix"}))
+
+	// The typed nil addresses are treated as not IP based.
+	var tcpAddr *net.TCPAddr
+	require.True(t, p.Allowed(tcpAddr))
+	var udpAddr *net.UDPAddr
+	require.True(t, p.Allowed(udpAddr))
+	p.Reload(AccessRules{Allow: allow})
+	require.False(t, p.Allowed(tcpAddr))
+}
+
+func TestAccessControlledListener(t *testing.T) {
+	deny, err := ParseIPSet("127.0.0.0/8")
+	require.Nil(t, err)
+	policy := NewAccessPolicy(AccessRules{Deny: deny})
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := NewServerFromListener(NewAccessControlledListener(l, policy), func(_ context.Context, conn net.Conn) {
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	})
+	go s.Serve()
+	defer s.Close()
+
+	conn, err := net.Dial("tcp4", s.ListenAddr().String())
+	require.Nil(t, err)
+	_, err = conn.Read(make([]byte, 1))
+	require.NotNil(t, err)
+	conn.Close()
+
+	policy.Reload(AccessRules{})
+	conn, err = net.Dial("tcp4", s.ListenAddr().String())
+	require.Nil(t, err)
+	testEcho(t, conn, "allowed")
+	conn.Close()
+}
+
+func TestAccessControlledPacketConn(t *testing.T) {
+	allow, err := ParseIPSet("10.0.0.0/8")
+	require.Nil(t, err)
+	var mu sync.Mutex
+	denied := 0
+	policy := NewAccessPolicy(AccessRules{Allow: allow},
+		WithAccessDecisionCallback(func(_ net.Addr, allowed bool) {
+			if !allowed {
+				mu.Lock()
+				denied++
+				mu.Unlock()
+			}
+		}))
+
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := NewPacketServerFromConn(NewAccessControlledPacketConn(pc, policy),
+		func(_ context.Context, conn net.PacketConn, addr net.Addr, data []byte) {
+			_, _ = conn.WriteTo(data, addr)
+		})
+	go s.Serve()
+	defer s.Close()
+
+	conn, err := net.Dial("udp4", s.ListenAddr().String())
+	require.Nil(t, err)
+	defer conn.Close()
+	buf := make([]byte, 16)
+	_, err = conn.Write([]byte("denied"))
+	require.Nil(t, err)
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	_, err = conn.Read(buf)
+	require.NotNil(t, err)
+	mu.Lock()
+	require.Equal(t, 1, denied)
+	mu.Unlock()
+
+	allow, err = ParseIPSet("10.0.0.0/8", "127.0.0.0/8")
+	require.Nil(t, err)
+	policy.Reload(AccessRules{Allow: allow})
+	_, err = conn.Write([]byte("allowed"))
+	require.Nil(t, err)
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	n, err := conn.Read(buf)
+	require.Nil(t, err)
+	require.Equal(t, "allowed", string(buf[:n]))
+}
@@ -0,0 +1,376 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNoSuitableAddress = errors.New("libext-go/net: no suitable address found")
+)
+
+const (
+	defaultDialAttempts      = 1
+	defaultDialFallbackDelay = 300 * time.Millisecond
+	defaultDialBackoffBase   = 100 * time.Millisecond
+	defaultDialBackoffMax    = 5 * time.Second
+	defaultDialBackoffJitter = 0.2
+)
+
+type (
+	DialerOptions struct {
+		attempts       int
+		attemptTimeout time.Duration
+		fallbackDelay  time.Duration
+		backoffBase    time.Duration
+		backoffMax     time.Duration
+		backoffJitter  float64
+		resolver       *net.Resolver
+		dialer         *net.Dialer
+	}
+	WithDialerOption func(opts *DialerOptions)
+)
+
+// WithDialAttempts sets the maximum number of dialing rounds, each round resolves
+// the host and races all the resolved addresses.
+func WithDialAttempts(attempts int) WithDialerOption {
+	return func(opts *DialerOptions) {
+		opts.attempts = attempts
+	}
+}
+
+// WithDialAttemptTimeout sets the timeout of the connection attempt to a single address.
+func WithDialAttemptTimeout(timeout time.Duration) WithDialerOption {
+	return func(opts *DialerOptions) {
+		opts.attemptTimeout = timeout
+	}
+}
+
+// WithDialFallbackDelay sets the delay before starting the connection attempt to
+// the next address while the previous one is still in progress, see RFC 8305.
+func WithDialFallbackDelay(delay time.Duration) WithDialerOption {
+	return func(opts *DialerOptions) {
+		opts.fallbackDelay = delay
+	}
+}
+
+// WithDialBackoff sets the backoff between dialing rounds, the backoff grows
+// exponentially from the base up to the max, and it is randomized by the jitter
+// factor within [0, 1].
+func WithDialBackoff(base, max time.Duration, jitter float64) WithDialerOption {
+	return func(opts *DialerOptions) {
+		opts.backoffBase = base
+		opts.backoffMax = max
+		opts.backoffJitter = jitter
+	}
+}
+
+// WithDialResolver sets the resolver used to lookup hosts.
+func WithDialResolver(resolver *net.Resolver) WithDialerOption {
+	return func(opts *DialerOptions) {
+		opts.resolver = resolver
+	}
+}
+
+// WithNetDialer sets the underlying dialer, its Timeout and DualStack related fields are ignored.
+// The dialer is copied.
+func WithNetDialer(dialer *net.Dialer) WithDialerOption {
+	return func(opts *DialerOptions) {
+		d := *dialer
+		d.Timeout = 0 // The timeout of each attempt is controlled by the Dialer.
+		opts.dialer = &d
+	}
+}
+
+var _defaultDialerOptions = []WithDialerOption{
+	WithDialAttempts(defaultDialAttempts),
+	WithDialFallbackDelay(defaultDialFallbackDelay),
+	WithDialBackoff(defaultDialBackoffBase, defaultDialBackoffMax, defaultDialBackoffJitter),
+	WithDialResolver(net.DefaultResolver),
+	WithNetDialer(&net.Dialer{}),
+}
+
+func makeDialerOptions(opts ...WithDialerOption) DialerOptions {
+	var dialerOpts DialerOptions
+	for _, opt := range _defaultDialerOptions {
+		opt(&dialerOpts)
+	}
+	for _, opt := range opts {
+		opt(&dialerOpts)
+	}
+	return dialerOpts
+}
+
+// DialAttemptError records the failure of a connection attempt.
+type DialAttemptError struct {
+	Round int
+	Addr  string
+	Err   error
+}
+
+func (e DialAttemptError) Error() string {
+	return "round " + strconv.Itoa(e.Round) + ": " + e.Addr + ": " + e.Err.Error()
+}
+
+// DialError aggregates all failed attempts of Dialer.DialContext.
+type DialError struct {
+	Network string
+	Address string
+	// Err is the reason why the dialing stops, it may be the context error.
+	Err      error
+	Attempts []DialAttemptError
+}
+
+func (e *DialError) Error() string {
+	var b strings.Builder
+	b.WriteString("libext-go/net: dial ")
+	b.WriteString(e.Network)
+	b.WriteString(" ")
+	b.WriteString(e.Address)
+	b.WriteString(": ")
+	b.WriteString(e.Err.Error())
+	if len(e.Attempts) > 0 {
+		b.WriteString(" (attempts: ")
+		for i, attempt := range e.Attempts {
+			if i > 0 {
+				b.WriteString("; ")
+			}
+			b.WriteString(attempt.Error())
+		}
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+func (e *DialError) Unwrap() error {
+	return e.Err
+}
+
+// Dialer connects to the host by racing the resolved addresses in the Happy Eyeballs
+// manner, the whole process will be retried with backoff if all addresses failed.
+type Dialer struct {
+	opts DialerOptions
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewDialer creates a new Dialer.
+func NewDialer(opts ...WithDialerOption) *Dialer {
+	return &Dialer{
+		opts: makeDialerOptions(opts...),
+		rnd:  rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+	}
+}
+
+// Dial is a shortcut for DialContext with the background context.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network, the network must be
+// one of "tcp", "tcp4", "tcp6", "udp", "udp4" and "udp6". The returned error is
+// a *DialError if the dialing failed.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	derr := &DialError{Network: network, Address: address}
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		derr.Err = err
+		return nil, derr
+	}
+
+	var timer *time.Timer
+	for round := 1; ; round++ {
+		conn, err := d.dialRound(ctx, network, host, port, round, derr)
+		if err == nil {
+			return conn, nil
+		}
+		derr.Err = err
+		if round >= d.opts.attempts || ctx.Err() != nil {
+			break
+		}
+
+		backoff := d.backoff(round)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+			derr.Err = context.DeadlineExceeded // It is meaningless to wait.
+			break
+		}
+		if timer == nil {
+			timer = time.NewTimer(backoff)
+			defer timer.Stop()
+		} else {
+			timer.Reset(backoff)
+		}
+		select {
+		case <-ctx.Done():
+		case <-timer.C:
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		derr.Err = err
+	}
+	return nil, derr
+}
+
+func (d *Dialer) dialRound(ctx context.Context, network, host, port string, round int, derr *DialError) (net.Conn, error) {
+	addrs, err := d.resolve(ctx, network, host)
+	if err != nil {
+		derr.Attempts = append(derr.Attempts, DialAttemptError{Round: round, Addr: host, Err: err})
+		return nil, err
+	}
+
+	type result struct {
+		conn net.Conn
+		addr string
+		err  error
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	resultc := make(chan result, len(addrs))
+	dial := func(addr string) {
+		dialCtx := ctx
+		if d.opts.attemptTimeout > 0 {
+			var cancel context.CancelFunc
+			dialCtx, cancel = context.WithTimeout(ctx, d.opts.attemptTimeout)
+			defer cancel()
+		}
+		conn, err := d.opts.dialer.DialContext(dialCtx, network, addr)
+		resultc <- result{conn: conn, addr: addr, err: err}
+	}
+
+	fallback := time.NewTimer(d.opts.fallbackDelay)
+	defer fallback.Stop()
+	next, pending := 0, 0
+	for {
+		if next < len(addrs) {
+			go dial(net.JoinHostPort(addrs[next].String(), port))
+			next++
+			pending++
+			if !fallback.Stop() {
+				select {
+				case <-fallback.C:
+				default:
+				}
+			}
+			fallback.Reset(d.opts.fallbackDelay)
+		}
+
+		var fallbackc <-chan time.Time
+		if next < len(addrs) {
+			fallbackc = fallback.C
+		}
+		select {
+		case <-fallbackc:
+			continue
+		case res := <-resultc:
+			pending--
+			if res.err == nil {
+				cancel()
+				go func(n int) { // Close the losers.
+					for ; n > 0; n-- {
+						if res := <-resultc; res.conn != nil {
+							res.conn.Close()
+						}
+					}
+				}(pending)
+				return res.conn, nil
+			}
+			if ctx.Err() == nil {
+				derr.Attempts = append(derr.Attempts, DialAttemptError{Round: round, Addr: res.addr, Err: res.err})
+			}
+			err = res.err
+			if pending == 0 && next == len(addrs) {
+				return nil, err
+			}
+			// Start the next attempt immediately.
+		}
+	}
+}
+
+func (d *Dialer) resolve(ctx context.Context, network, host string) ([]net.IP, error) {
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		ipaddrs, err := d.opts.resolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		ips = make([]net.IP, 0, len(ipaddrs))
+		for _, ipaddr := range ipaddrs {
+			ips = append(ips, ipaddr.IP)
+		}
+	}
+
+	var v4only, v6only bool
+	switch network {
+	case "tcp4", "udp4":
+		v4only = true
+	case "tcp6", "udp6":
+		v6only = true
+	}
+	filtered := ips[:0]
+	for _, ip := range ips {
+		isv4 := ip.To4() != nil
+		if (v4only && !isv4) || (v6only && isv4) {
+			continue
+		}
+		filtered = append(filtered, ip)
+	}
+	if len(filtered) == 0 {
+		return nil, ErrNoSuitableAddress
+	}
+	return interleaveIPFamilies(filtered), nil
+}
+
+// interleaveIPFamilies sorts addresses by alternating the address families,
+// the family of the first address goes first, see RFC 8305 section 4.
+func interleaveIPFamilies(ips []net.IP) []net.IP {
+	primaryIsV4 := ips[0].To4() != nil
+	var primaries, fallbacks []net.IP
+	for _, ip := range ips {
+		if (ip.To4() != nil) == primaryIsV4 {
+			primaries = append(primaries, ip)
+		} else {
+			fallbacks = append(fallbacks, ip)
+		}
+	}
+
+	sorted := make([]net.IP, 0, len(ips))
+	for i := 0; i < len(primaries) || i < len(fallbacks); i++ {
+		if i < len(primaries) {
+			sorted = append(sorted, primaries[i])
+		}
+		if i < len(fallbacks) {
+			sorted = append(sorted, fallbacks[i])
+		}
+	}
+	return sorted
+}
+
+func (d *Dialer) backoff(round int) time.Duration {
+	backoff := d.opts.backoffBase
+	for i := 1; i < round && backoff < d.opts.backoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > d.opts.backoffMax {
+		backoff = d.opts.backoffMax
+	}
+	if jitter := d.opts.backoffJitter; jitter > 0 {
+		d.mu.Lock()
+		delta := (d.rnd.Float64()*2 - 1) * jitter * float64(backoff)
+		d.mu.Unlock()
+		backoff += time.Duration(delta)
+	}
+	if backoff < 0 {
+		backoff = 0
+	}
+	return backoff
+}
@@ -0,0 +1,107 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialer(t *testing.T) {
+	s := startEchoServer(t)
+	defer s.Close()
+	_, port, err := net.SplitHostPort(s.ListenAddr().String())
+	require.Nil(t, err)
+
+	d := NewDialer(WithDialFallbackDelay(10 * time.Millisecond))
+	conn, err := d.Dial("tcp", net.JoinHostPort("127.0.0.1", port))
+	require.Nil(t, err)
+	testEcho(t, conn, "hello")
+	require.Nil(t, conn.Close())
+
+	// The ::1 may be resolved and it must fail since the server only listens on IPv4.
+	conn, err = d.Dial("tcp", net.JoinHostPort("localhost", port))
+	require.Nil(t, err)
+	testEcho(t, conn, "world")
+	require.Nil(t, conn.Close())
+
+	_, err = d.Dial("tcp6", net.JoinHostPort("127.0.0.1", port))
+	var derr *DialError
+	require.True(t, errors.As(err, &derr))
+	require.Equal(t, ErrNoSuitableAddress, derr.Err)
+}
+
+func TestDialer_Retry(t *testing.T) {
+	addr := randLoopbackAddr(t)
+	d := NewDialer(WithDialAttempts(3), WithDialBackoff(5*time.Millisecond, 10*time.Millisecond, 0.5))
+	_, err := d.Dial("tcp4", addr)
+	var derr *DialError
+	require.True(t, errors.As(err, &derr))
+	require.Len(t, derr.Attempts, 3)
+	for i, attempt := range derr.Attempts {
+		require.Equal(t, i+1, attempt.Round)
+		require.NotNil(t, attempt.Err)
+	}
+
+	d = NewDialer(WithDialAttempts(100), WithDialBackoff(10*time.Millisecond, 20*time.Millisecond, 0))
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		s, err := NewTCPServer(addr, func(context.Context, net.Conn) {})
+		if err == nil {
+			go s.Serve()
+			time.Sleep(time.Second)
+			s.Close()
+		}
+	}()
+	conn, err := d.Dial("tcp4", addr)
+	require.Nil(t, err)
+	require.Nil(t, conn.Close())
+}
+
+func TestDialer_Context(t *testing.T) {
+	addr := randLoopbackAddr(t)
+	d := NewDialer(WithDialAttempts(100), WithDialBackoff(10*time.Millisecond, 10*time.Millisecond, 0))
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := d.DialContext(ctx, "tcp4", addr)
+	require.True(t, errors.Is(err, context.DeadlineExceeded))
+	require.True(t, time.Since(start) < time.Second)
+}
+
+func TestDialer_IgnoreNetDialerTimeout(t *testing.T) {
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	nd := &net.Dialer{Timeout: time.Nanosecond}
+	d := NewDialer(WithDialAttempts(1), WithNetDialer(nd))
+	conn, err := d.Dial("tcp4", l.Addr().String())
+	require.Nil(t, err)
+	require.Nil(t, conn.Close())
+	require.Equal(t, time.Nanosecond, nd.Timeout)
+}
+
+func TestInterleaveIPFamilies(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("::1"), net.ParseIP("::2"), net.ParseIP("::3"),
+		net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2"),
+	}
+	expected := []net.IP{
+		net.ParseIP("::1"), net.ParseIP("127.0.0.1"), net.ParseIP("::2"),
+		net.ParseIP("127.0.0.2"), net.ParseIP("::3"),
+	}
+	require.Equal(t, expected, interleaveIPFamilies(ips))
+}
+
+func randLoopbackAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	return l.Addr().String()
+}
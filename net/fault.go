@@ -0,0 +1,367 @@
+package net
+
+import (
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+var (
+	ErrInjectedReset = errors.New("libext-go/net: connection reset by fault injection")
+)
+
+type (
+	FaultOptions struct {
+		seed         int64
+		latency      time.Duration
+		jitter       time.Duration
+		bandwidth    int
+		shortIOProb  float64
+		resetAfter   int64
+		lossProb     float64
+		dupProb      float64
+		reorderProb  float64
+		reorderDelay time.Duration
+	}
+	WithFaultOption func(opts *FaultOptions)
+)
+
+// WithFaultSeed sets the seed of the RNG which drives all the faults,
+// the same seed produces the same faults for the same sequence of operations.
+func WithFaultSeed(seed int64) WithFaultOption {
+	return func(opts *FaultOptions) {
+		opts.seed = seed
+	}
+}
+
+// WithFaultLatency delays each Read/Write(or each packet) by the latency plus
+// a random duration in [-jitter, jitter].
+func WithFaultLatency(latency, jitter time.Duration) WithFaultOption {
+	return func(opts *FaultOptions) {
+		opts.latency = latency
+		opts.jitter = jitter
+	}
+}
+
+// WithFaultBandwidth caps the throughput of each direction in bytes per second,
+// zero means unlimited.
+func WithFaultBandwidth(bytesPerSecond int) WithFaultOption {
+	return func(opts *FaultOptions) {
+		opts.bandwidth = bytesPerSecond
+	}
+}
+
+// WithFaultShortIO makes Read return partial data and Write write partial data
+// with io.ErrShortWrite by the probability.
+func WithFaultShortIO(prob float64) WithFaultOption {
+	return func(opts *FaultOptions) {
+		opts.shortIOProb = prob
+	}
+}
+
+// WithFaultResetAfter resets the connection after n bytes has been read and
+// written in total, zero disables it.
+func WithFaultResetAfter(n int64) WithFaultOption {
+	return func(opts *FaultOptions) {
+		opts.resetAfter = n
+	}
+}
+
+// WithFaultPacketLoss drops packets by the probability.
+func WithFaultPacketLoss(prob float64) WithFaultOption {
+	return func(opts *FaultOptions) {
+		opts.lossProb = prob
+	}
+}
+
+// WithFaultPacketDuplication duplicates packets by the probability.
+func WithFaultPacketDuplication(prob float64) WithFaultOption {
+	return func(opts *FaultOptions) {
+		opts.dupProb = prob
+	}
+}
+
+// WithFaultPacketReorder holds the outgoing packets for an extra delay by
+// the probability, so the packets sent after them arrive first.
+func WithFaultPacketReorder(prob float64, delay time.Duration) WithFaultOption {
+	return func(opts *FaultOptions) {
+		opts.reorderProb = prob
+		opts.reorderDelay = delay
+	}
+}
+
+var _defaultFaultOptions = []WithFaultOption{
+	WithFaultSeed(1),
+}
+
+func makeFaultOptions(opts ...WithFaultOption) FaultOptions {
+	var faultOpts FaultOptions
+	for _, opt := range _defaultFaultOptions {
+		opt(&faultOpts)
+	}
+	for _, opt := range opts {
+		opt(&faultOpts)
+	}
+	return faultOpts
+}
+
+// faultInjector makes the decisions, it is safe for concurrent use.
+type faultInjector struct {
+	opts FaultOptions
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newFaultInjector(opts FaultOptions) *faultInjector {
+	return &faultInjector{
+		opts: opts,
+		rnd:  rand.New(rand.NewSource(opts.seed)), //nolint:gosec
+	}
+}
+
+func (fi *faultInjector) hit(prob float64) bool {
+	if prob <= 0 {
+		return false
+	}
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.rnd.Float64() < prob
+}
+
+func (fi *faultInjector) intn(n int) int {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.rnd.Intn(n)
+}
+
+func (fi *faultInjector) latency() time.Duration {
+	d := fi.opts.latency
+	if jitter := int64(fi.opts.jitter); jitter > 0 {
+		fi.mu.Lock()
+		d += time.Duration(fi.rnd.Int63n(2*jitter+1) - jitter)
+		fi.mu.Unlock()
+	}
+	if d < 0 {
+		d = 0
+	}
+	return d
+}
+
+// delay sleeps for the latency and the time of transferring n bytes.
+func (fi *faultInjector) delay(n int) {
+	d := fi.latency()
+	if fi.opts.bandwidth > 0 && n > 0 {
+		d += time.Duration(int64(n) * int64(time.Second) / int64(fi.opts.bandwidth))
+	}
+	if d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// shorten returns a random non-empty prefix of p by the probability.
+func (fi *faultInjector) shorten(p []byte) []byte {
+	if len(p) > 1 && fi.hit(fi.opts.shortIOProb) {
+		return p[:1+fi.intn(len(p)-1)]
+	}
+	return p
+}
+
+// FaultConn injects faults into a net.Conn, it composes with NewTimedConn
+// since it is a net.Conn as well.
+type FaultConn struct {
+	net.Conn
+
+	fi          *faultInjector
+	transferred *atomic.Int64
+	reset       *atomic.Bool
+}
+
+// NewFaultConn wraps the conn to inject faults.
+func NewFaultConn(conn net.Conn, opts ...WithFaultOption) *FaultConn {
+	return newFaultConn(conn, makeFaultOptions(opts...))
+}
+
+func newFaultConn(conn net.Conn, opts FaultOptions) *FaultConn {
+	return &FaultConn{
+		Conn:        conn,
+		fi:          newFaultInjector(opts),
+		transferred: atomic.NewInt64(0),
+		reset:       atomic.NewBool(false),
+	}
+}
+
+func (c *FaultConn) Read(p []byte) (int, error) {
+	p, err := c.limit(p)
+	if err != nil {
+		return 0, err
+	}
+	p = c.fi.shorten(p)
+	n, err := c.Conn.Read(p)
+	c.transferred.Add(int64(n))
+	c.fi.delay(n)
+	return n, err
+}
+
+func (c *FaultConn) Write(b []byte) (int, error) {
+	p, err := c.limit(b)
+	if err != nil {
+		return 0, err
+	}
+	p = c.fi.shorten(p)
+	c.fi.delay(len(p))
+	n, err := c.Conn.Write(p)
+	c.transferred.Add(int64(n))
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+		if c.reset.Load() || c.exhausted() {
+			err = c.doReset()
+		}
+	}
+	return n, err
+}
+
+// limit truncates p to the bytes left before the reset, it resets the
+// connection if there is nothing left.
+func (c *FaultConn) limit(p []byte) ([]byte, error) {
+	if c.reset.Load() {
+		return nil, ErrInjectedReset
+	}
+	if c.fi.opts.resetAfter <= 0 || len(p) == 0 {
+		return p, nil
+	}
+	left := c.fi.opts.resetAfter - c.transferred.Load()
+	if left <= 0 {
+		return nil, c.doReset()
+	}
+	if int64(len(p)) > left {
+		p = p[:left]
+	}
+	return p, nil
+}
+
+func (c *FaultConn) exhausted() bool {
+	return c.fi.opts.resetAfter > 0 && c.transferred.Load() >= c.fi.opts.resetAfter
+}
+
+func (c *FaultConn) doReset() error {
+	if c.reset.CAS(false, true) {
+		if tc, ok := c.Conn.(*net.TCPConn); ok {
+			_ = tc.SetLinger(0) // Send RST instead of FIN.
+		}
+		_ = c.Conn.Close()
+	}
+	return ErrInjectedReset
+}
+
+type faultListener struct {
+	net.Listener
+
+	opts FaultOptions
+	seq  *atomic.Int64
+}
+
+// NewFaultListener wraps the accepted connections to inject faults, the seed
+// of each connection is derived from the seed option and the accepted order.
+func NewFaultListener(l net.Listener, opts ...WithFaultOption) net.Listener {
+	return faultListener{
+		Listener: l,
+		opts:     makeFaultOptions(opts...),
+		seq:      atomic.NewInt64(0),
+	}
+}
+
+func (l faultListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	opts := l.opts
+	opts.seed += l.seq.Inc() - 1
+	return newFaultConn(conn, opts), nil
+}
+
+// FaultPacketConn injects faults into a net.PacketConn, the incoming packets
+// may be lost or duplicated, the outgoing packets may be delayed, lost,
+// duplicated or reordered.
+type FaultPacketConn struct {
+	net.PacketConn
+
+	fi *faultInjector
+
+	mu      sync.Mutex
+	pending []byte // The duplicated incoming packet.
+	from    net.Addr
+}
+
+// NewFaultPacketConn wraps the conn to inject faults.
+func NewFaultPacketConn(conn net.PacketConn, opts ...WithFaultOption) *FaultPacketConn {
+	return &FaultPacketConn{
+		PacketConn: conn,
+		fi:         newFaultInjector(makeFaultOptions(opts...)),
+	}
+}
+
+func (c *FaultPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	c.mu.Lock()
+	if c.pending != nil {
+		n, addr := copy(p, c.pending), c.from
+		c.pending, c.from = nil, nil
+		c.mu.Unlock()
+		return n, addr, nil
+	}
+	c.mu.Unlock()
+
+	for {
+		n, addr, err := c.PacketConn.ReadFrom(p)
+		if err != nil {
+			return n, addr, err
+		}
+		if c.fi.hit(c.fi.opts.lossProb) {
+			continue
+		}
+		if c.fi.hit(c.fi.opts.dupProb) {
+			c.mu.Lock()
+			c.pending, c.from = append([]byte(nil), p[:n]...), addr
+			c.mu.Unlock()
+		}
+		return n, addr, nil
+	}
+}
+
+// WriteTo writes the packet, it returns immediately if the packet is delayed,
+// and the error of the delayed writing is discarded.
+func (c *FaultPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	if c.fi.hit(c.fi.opts.lossProb) {
+		return len(b), nil
+	}
+	copies := 1
+	if c.fi.hit(c.fi.opts.dupProb) {
+		copies = 2
+	}
+	delay := c.fi.latency()
+	if c.fi.hit(c.fi.opts.reorderProb) {
+		delay += c.fi.opts.reorderDelay
+	}
+	if delay <= 0 {
+		for i := 0; i < copies; i++ {
+			if n, err := c.PacketConn.WriteTo(b, addr); err != nil {
+				return n, err
+			}
+		}
+		return len(b), nil
+	}
+
+	data := append([]byte(nil), b...)
+	time.AfterFunc(delay, func() {
+		for i := 0; i < copies; i++ {
+			_, _ = c.PacketConn.WriteTo(data, addr)
+		}
+	})
+	return len(b), nil
+}
@@ -0,0 +1,137 @@
+package net
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFaultConnReset(t *testing.T) {
+	c1, c2 := MemPipe()
+	fc := NewFaultConn(c1, WithFaultResetAfter(6))
+
+	n, err := fc.Write([]byte("abc"))
+	require.Nil(t, err)
+	require.Equal(t, 3, n)
+	n, err = fc.Write([]byte("defgh"))
+	require.Equal(t, ErrInjectedReset, err)
+	require.Equal(t, 3, n)
+	_, err = fc.Read(make([]byte, 1))
+	require.Equal(t, ErrInjectedReset, err)
+
+	data, err := ioutil.ReadAll(c2)
+	require.Nil(t, err)
+	require.Equal(t, "abcdef", string(data))
+}
+
+func TestFaultConnShortIO(t *testing.T) {
+	readSizes := func() []int {
+		c1, c2 := MemPipe()
+		fc := NewFaultConn(c1, WithFaultSeed(42), WithFaultShortIO(0.5))
+		_, err := c2.Write(make([]byte, 1024))
+		require.Nil(t, err)
+		require.Nil(t, c2.Close())
+
+		var sizes []int
+		buf := make([]byte, 64)
+		for {
+			n, err := fc.Read(buf)
+			if err == io.EOF {
+				break
+			}
+			require.Nil(t, err)
+			sizes = append(sizes, n)
+		}
+		return sizes
+	}
+	sizes := readSizes()
+	require.Equal(t, sizes, readSizes())
+	total, short := 0, 0
+	for _, n := range sizes {
+		total += n
+		if n < 64 {
+			short++
+		}
+	}
+	require.Equal(t, 1024, total)
+	require.True(t, short > 0)
+
+	c1, _ := MemPipe()
+	fc := NewFaultConn(c1, WithFaultShortIO(1))
+	n, err := fc.Write([]byte("abc"))
+	require.Equal(t, io.ErrShortWrite, err)
+	require.True(t, n < 3)
+}
+
+func TestFaultConnDelay(t *testing.T) {
+	c1, c2 := MemPipe()
+	defer c2.Close()
+	tc := NewTimedConn(NewFaultConn(c1, WithFaultLatency(20*time.Millisecond, 0), WithFaultBandwidth(1000)),
+		time.Second, time.Second)
+
+	start := time.Now()
+	_, err := tc.Write(make([]byte, 30))
+	require.Nil(t, err)
+	require.True(t, time.Since(start) >= 50*time.Millisecond)
+	require.Nil(t, tc.Close())
+}
+
+func TestFaultListener(t *testing.T) {
+	l := NewMemListener("fault")
+	s := NewServerFromListener(NewFaultListener(l, WithFaultLatency(time.Millisecond, time.Millisecond), WithFaultBandwidth(1<<20)),
+		func(_ context.Context, conn net.Conn) {
+			defer conn.Close()
+			_, _ = io.Copy(conn, conn)
+		})
+	go s.Serve()
+	defer s.Close()
+
+	conn, err := l.Dial()
+	require.Nil(t, err)
+	defer conn.Close()
+	testEcho(t, conn, "hello, bad network")
+}
+
+func TestFaultPacketConn(t *testing.T) {
+	c1, c2 := NewMemPacketConnPair("c1", "c2")
+	buf := make([]byte, 8)
+	read := func() string {
+		require.Nil(t, c2.SetReadDeadline(time.Now().Add(time.Second)))
+		n, _, err := c2.ReadFrom(buf)
+		require.Nil(t, err)
+		return string(buf[:n])
+	}
+
+	lossy := NewFaultPacketConn(c1, WithFaultPacketLoss(1))
+	_, err := lossy.WriteTo([]byte("lost"), c2.LocalAddr())
+	require.Nil(t, err)
+	dup := NewFaultPacketConn(c1, WithFaultPacketDuplication(1))
+	_, err = dup.WriteTo([]byte("dup"), c2.LocalAddr())
+	require.Nil(t, err)
+	require.Equal(t, "dup", read())
+	require.Equal(t, "dup", read())
+
+	reorder := NewFaultPacketConn(c1, WithFaultPacketReorder(1, 20*time.Millisecond))
+	_, err = reorder.WriteTo([]byte("1"), c2.LocalAddr())
+	require.Nil(t, err)
+	_, err = c1.WriteTo([]byte("2"), c2.LocalAddr())
+	require.Nil(t, err)
+	require.Equal(t, "2", read())
+	require.Equal(t, "1", read())
+
+	// Incoming.
+	fc2 := NewFaultPacketConn(c2, WithFaultPacketDuplication(1))
+	_, err = c1.WriteTo([]byte("in"), c2.LocalAddr())
+	require.Nil(t, err)
+	for i := 0; i < 2; i++ {
+		n, addr, err := fc2.ReadFrom(buf)
+		require.Nil(t, err)
+		require.Equal(t, "in", string(buf[:n]))
+		require.Equal(t, "c1", addr.String())
+	}
+}
@@ -0,0 +1,272 @@
+package net
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+var (
+	ErrHeartbeatTimeout = errors.New("libext-go/net: heartbeat timeout")
+	ErrHeartbeatClosed  = errors.New("libext-go/net: heartbeat closed")
+)
+
+const (
+	defaultHeartbeatInterval = 10 * time.Second
+	defaultHeartbeatTimeout  = 5 * time.Second
+)
+
+// HeartbeatFrameKind is the kind of heartbeat frames.
+type HeartbeatFrameKind int
+
+const (
+	HeartbeatPing HeartbeatFrameKind = iota + 1
+	HeartbeatPong
+)
+
+// HeartbeatCodec encodes and decodes the ping/pong frames, so the heartbeat
+// can be embedded into any framing protocol.
+type HeartbeatCodec interface {
+	// Encode returns the frame of the kind with the sequence number.
+	Encode(kind HeartbeatFrameKind, seq uint64) []byte
+	// Decode reports whether the frame is a heartbeat frame.
+	Decode(frame []byte) (kind HeartbeatFrameKind, seq uint64, ok bool)
+}
+
+type magicHeartbeatCodec struct {
+	ping []byte
+	pong []byte
+}
+
+// NewMagicHeartbeatCodec creates a HeartbeatCodec which encodes a frame as
+// the magic followed by the big endian uint64 sequence number.
+func NewMagicHeartbeatCodec(pingMagic, pongMagic []byte) HeartbeatCodec {
+	return magicHeartbeatCodec{ping: pingMagic, pong: pongMagic}
+}
+
+func (c magicHeartbeatCodec) Encode(kind HeartbeatFrameKind, seq uint64) []byte {
+	magic := c.ping
+	if kind == HeartbeatPong {
+		magic = c.pong
+	}
+	frame := make([]byte, len(magic)+8)
+	copy(frame, magic)
+	binary.BigEndian.PutUint64(frame[len(magic):], seq)
+	return frame
+}
+
+func (c magicHeartbeatCodec) Decode(frame []byte) (HeartbeatFrameKind, uint64, bool) {
+	if len(frame) == len(c.ping)+8 && bytes.HasPrefix(frame, c.ping) {
+		return HeartbeatPing, binary.BigEndian.Uint64(frame[len(c.ping):]), true
+	}
+	if len(frame) == len(c.pong)+8 && bytes.HasPrefix(frame, c.pong) {
+		return HeartbeatPong, binary.BigEndian.Uint64(frame[len(c.pong):]), true
+	}
+	return 0, 0, false
+}
+
+type (
+	HeartbeatOptions struct {
+		interval time.Duration
+		timeout  time.Duration
+		onRTT    func(rtt time.Duration)
+		onDead   func(err error)
+	}
+	WithHeartbeatOption func(opts *HeartbeatOptions)
+)
+
+// WithHeartbeatInterval sets the interval of sending pings.
+func WithHeartbeatInterval(interval time.Duration) WithHeartbeatOption {
+	return func(opts *HeartbeatOptions) {
+		opts.interval = interval
+	}
+}
+
+// WithHeartbeatTimeout sets the deadline of the pong after the ping is sent.
+func WithHeartbeatTimeout(timeout time.Duration) WithHeartbeatOption {
+	return func(opts *HeartbeatOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// WithHeartbeatRTTCallback sets the callback which receives the RTT samples.
+func WithHeartbeatRTTCallback(onRTT func(rtt time.Duration)) WithHeartbeatOption {
+	return func(opts *HeartbeatOptions) {
+		opts.onRTT = onRTT
+	}
+}
+
+// WithHeartbeatDeadCallback sets the callback which is called after the
+// connection is closed due to the heartbeat failure.
+func WithHeartbeatDeadCallback(onDead func(err error)) WithHeartbeatOption {
+	return func(opts *HeartbeatOptions) {
+		opts.onDead = onDead
+	}
+}
+
+var _defaultHeartbeatOptions = []WithHeartbeatOption{
+	WithHeartbeatInterval(defaultHeartbeatInterval),
+	WithHeartbeatTimeout(defaultHeartbeatTimeout),
+	WithHeartbeatRTTCallback(func(time.Duration) {}),
+	WithHeartbeatDeadCallback(func(error) {}),
+}
+
+func makeHeartbeatOptions(opts ...WithHeartbeatOption) HeartbeatOptions {
+	var hbOpts HeartbeatOptions
+	for _, opt := range _defaultHeartbeatOptions {
+		opt(&hbOpts)
+	}
+	for _, opt := range opts {
+		opt(&hbOpts)
+	}
+	return hbOpts
+}
+
+type pendingPing struct {
+	sentAt time.Time
+	timer  *time.Timer
+}
+
+// Heartbeat sends pings on the conn periodically and closes the conn if the pong
+// is not received in time. The Heartbeat is a net.Conn whose Write is serialized
+// with the pings, so each frame must be written by a single Write. The frames
+// read from the conn must be passed to HandleFrame to answer pings and collect pongs.
+type Heartbeat struct {
+	net.Conn
+
+	codec HeartbeatCodec
+	opts  HeartbeatOptions
+	rtt   *atomic.Duration
+
+	wmu sync.Mutex
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]pendingPing
+
+	closec    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewHeartbeat creates a Heartbeat and starts sending pings.
+func NewHeartbeat(conn net.Conn, codec HeartbeatCodec, opts ...WithHeartbeatOption) *Heartbeat {
+	h := &Heartbeat{
+		Conn:    conn,
+		codec:   codec,
+		opts:    makeHeartbeatOptions(opts...),
+		rtt:     atomic.NewDuration(0),
+		pending: make(map[uint64]pendingPing),
+		closec:  make(chan struct{}),
+	}
+	go h.run()
+	return h
+}
+
+func (h *Heartbeat) Write(b []byte) (int, error) {
+	h.wmu.Lock()
+	defer h.wmu.Unlock()
+	return h.Conn.Write(b)
+}
+
+// HandleFrame answers the ping and collects the pong, it reports whether the
+// frame is a heartbeat frame, the other frames should be handled by the caller.
+func (h *Heartbeat) HandleFrame(frame []byte) bool {
+	kind, seq, ok := h.codec.Decode(frame)
+	if !ok {
+		return false
+	}
+
+	switch kind {
+	case HeartbeatPing:
+		if _, err := h.Write(h.codec.Encode(HeartbeatPong, seq)); err != nil {
+			h.die(err)
+		}
+	case HeartbeatPong:
+		h.mu.Lock()
+		p, ok := h.pending[seq]
+		delete(h.pending, seq)
+		h.mu.Unlock()
+		if ok && p.timer.Stop() {
+			rtt := time.Since(p.sentAt)
+			h.rtt.Store(rtt)
+			h.opts.onRTT(rtt)
+		}
+	}
+	return true
+}
+
+// RTT returns the latest RTT sample, it is zero if there is no sample yet.
+func (h *Heartbeat) RTT() time.Duration {
+	return h.rtt.Load()
+}
+
+// Close stops the heartbeat and closes the conn, it returns ErrHeartbeatClosed
+// if the heartbeat has been closed.
+func (h *Heartbeat) Close() error {
+	err := ErrHeartbeatClosed
+	h.closeOnce.Do(func() {
+		close(h.closec)
+		h.stopTimers()
+		err = h.Conn.Close()
+	})
+	return err
+}
+
+func (h *Heartbeat) run() {
+	ticker := time.NewTicker(h.opts.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := h.ping(); err != nil {
+				h.die(err)
+				return
+			}
+		case <-h.closec:
+			return
+		}
+	}
+}
+
+func (h *Heartbeat) ping() error {
+	h.mu.Lock()
+	h.seq++
+	seq := h.seq
+	h.pending[seq] = pendingPing{
+		sentAt: time.Now(),
+		timer: time.AfterFunc(h.opts.timeout, func() {
+			h.die(ErrHeartbeatTimeout)
+		}),
+	}
+	h.mu.Unlock()
+
+	_, err := h.Write(h.codec.Encode(HeartbeatPing, seq))
+	return err
+}
+
+func (h *Heartbeat) die(err error) {
+	dead := false
+	h.closeOnce.Do(func() {
+		close(h.closec)
+		h.stopTimers()
+		_ = h.Conn.Close()
+		dead = true
+	})
+	if dead {
+		h.opts.onDead(err)
+	}
+}
+
+func (h *Heartbeat) stopTimers() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for seq, p := range h.pending {
+		p.timer.Stop()
+		delete(h.pending, seq)
+	}
+}
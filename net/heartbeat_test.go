@@ -0,0 +1,81 @@
+package net
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
+)
+
+// All the frames are 12 bytes in the test protocol.
+func readHeartbeatFrames(conn net.Conn, hb *Heartbeat, dataFrames chan<- string) {
+	frame := make([]byte, 12)
+	for {
+		if _, err := io.ReadFull(conn, frame); err != nil {
+			close(dataFrames)
+			return
+		}
+		if hb == nil || !hb.HandleFrame(frame) {
+			dataFrames <- string(frame)
+		}
+	}
+}
+
+func TestHeartbeat(t *testing.T) {
+	codec := NewMagicHeartbeatCodec([]byte("PING"), []byte("PONG"))
+	c1, c2 := MemPipe()
+	rtts := atomic.NewInt32(0)
+	hb1 := NewHeartbeat(c1, codec, WithHeartbeatInterval(5*time.Millisecond),
+		WithHeartbeatTimeout(time.Second),
+		WithHeartbeatRTTCallback(func(rtt time.Duration) {
+			rtts.Inc()
+		}))
+	defer hb1.Close()
+	hb2 := NewHeartbeat(c2, codec, WithHeartbeatInterval(time.Hour))
+	defer hb2.Close()
+
+	data1, data2 := make(chan string, 1), make(chan string, 1)
+	go readHeartbeatFrames(hb1, hb1, data1)
+	go readHeartbeatFrames(hb2, hb2, data2)
+
+	_, err := hb1.Write([]byte("DATA01234567"))
+	require.Nil(t, err)
+	require.Equal(t, "DATA01234567", <-data2)
+	for rtts.Load() < 3 {
+		time.Sleep(5 * time.Millisecond)
+	}
+	require.True(t, hb1.RTT() > 0)
+	require.Equal(t, time.Duration(0), hb2.RTT())
+
+	require.Nil(t, hb1.Close())
+	require.Equal(t, ErrHeartbeatClosed, hb1.Close())
+	_, ok := <-data2
+	require.False(t, ok)
+}
+
+func TestHeartbeatDead(t *testing.T) {
+	codec := NewMagicHeartbeatCodec([]byte("PING"), []byte("PONG"))
+	c1, c2 := MemPipe()
+	defer c2.Close()
+	deadc := make(chan error, 1)
+	hb := NewHeartbeat(c1, codec, WithHeartbeatInterval(5*time.Millisecond),
+		WithHeartbeatTimeout(10*time.Millisecond),
+		WithHeartbeatDeadCallback(func(err error) { deadc <- err }))
+	data := make(chan string, 16)
+	go readHeartbeatFrames(c2, nil, data) // Never answers.
+
+	require.Equal(t, ErrHeartbeatTimeout, <-deadc)
+	_, err := hb.Write([]byte("DATA01234567"))
+	require.Equal(t, io.ErrClosedPipe, err)
+	require.Equal(t, ErrHeartbeatClosed, hb.Close())
+
+	kind, seq, ok := codec.Decode([]byte(<-data))
+	require.True(t, ok)
+	require.Equal(t, HeartbeatPing, kind)
+	require.Equal(t, uint64(1), seq)
+	_, _, ok = codec.Decode([]byte("PING"))
+	require.False(t, ok)
+}
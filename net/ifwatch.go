@@ -0,0 +1,396 @@
+package net
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+var (
+	ErrWatcherClosed = errors.New("libext-go/net: watcher closed")
+
+	errInterfaceNotifierNotSupported = errors.New("libext-go/net: interface notifier not supported")
+)
+
+const (
+	defaultWatcherPollInterval = 5 * time.Second
+	defaultWatcherEventsBuffer = 64
+)
+
+// InterfaceEventType is the type of InterfaceEvent.
+type InterfaceEventType int
+
+const (
+	InterfaceAdded InterfaceEventType = iota + 1
+	InterfaceRemoved
+	InterfaceUp
+	InterfaceDown
+	AddressAdded
+	AddressRemoved
+)
+
+func (t InterfaceEventType) String() string {
+	switch t {
+	case InterfaceAdded:
+		return "InterfaceAdded"
+	case InterfaceRemoved:
+		return "InterfaceRemoved"
+	case InterfaceUp:
+		return "InterfaceUp"
+	case InterfaceDown:
+		return "InterfaceDown"
+	case AddressAdded:
+		return "AddressAdded"
+	case AddressRemoved:
+		return "AddressRemoved"
+	default:
+		return "Unknown"
+	}
+}
+
+// InterfaceEvent describes a change of the network interfaces,
+// the Addr is only set for the address events.
+type InterfaceEvent struct {
+	Type      InterfaceEventType
+	Interface net.Interface
+	Addr      *net.IPNet
+}
+
+type (
+	InterfaceWatcherOptions struct {
+		pollInterval time.Duration
+		pollingOnly  bool
+	}
+	WithInterfaceWatcherOption func(opts *InterfaceWatcherOptions)
+)
+
+// WithWatcherPollInterval sets the interval of polling the interfaces, it is
+// the interval of resynchronization if the change notification is available.
+func WithWatcherPollInterval(interval time.Duration) WithInterfaceWatcherOption {
+	return func(opts *InterfaceWatcherOptions) {
+		opts.pollInterval = interval
+	}
+}
+
+// WithWatcherPollingOnly disables the change notification(netlink on Linux),
+// the changes are detected by polling only.
+func WithWatcherPollingOnly() WithInterfaceWatcherOption {
+	return func(opts *InterfaceWatcherOptions) {
+		opts.pollingOnly = true
+	}
+}
+
+var _defaultInterfaceWatcherOptions = []WithInterfaceWatcherOption{
+	WithWatcherPollInterval(defaultWatcherPollInterval),
+}
+
+func makeInterfaceWatcherOptions(opts ...WithInterfaceWatcherOption) InterfaceWatcherOptions {
+	var watcherOpts InterfaceWatcherOptions
+	for _, opt := range _defaultInterfaceWatcherOptions {
+		opt(&watcherOpts)
+	}
+	for _, opt := range opts {
+		opt(&watcherOpts)
+	}
+	return watcherOpts
+}
+
+// interfaceState is the snapshot of an interface.
+type interfaceState struct {
+	iface net.Interface
+	addrs []*net.IPNet
+}
+
+// InterfaceWatcher emits events when the network interfaces come up/down or
+// the addresses are added/removed. On Linux the changes are notified by netlink,
+// otherwise, or if netlink is unavailable, the interfaces are polled periodically.
+type InterfaceWatcher struct {
+	opts           InterfaceWatcherOptions
+	listInterfaces func() ([]interfaceState, error)
+	snapshot       map[string]interfaceState
+
+	notifier io.Closer
+	changec  chan struct{}
+	events   chan InterfaceEvent
+
+	closec    chan struct{}
+	donec     chan struct{}
+	closeOnce sync.Once
+}
+
+// NewInterfaceWatcher creates an InterfaceWatcher and starts watching, the
+// current interfaces are taken as the baseline and not emitted as events.
+func NewInterfaceWatcher(opts ...WithInterfaceWatcherOption) (*InterfaceWatcher, error) {
+	return newInterfaceWatcher(listInterfaces, opts...)
+}
+
+func newInterfaceWatcher(list func() ([]interfaceState, error), opts ...WithInterfaceWatcherOption) (*InterfaceWatcher, error) {
+	w := &InterfaceWatcher{
+		opts:           makeInterfaceWatcherOptions(opts...),
+		listInterfaces: list,
+		changec:        make(chan struct{}, 1),
+		events:         make(chan InterfaceEvent, defaultWatcherEventsBuffer),
+		closec:         make(chan struct{}),
+		donec:          make(chan struct{}),
+	}
+	states, err := list()
+	if err != nil {
+		return nil, err
+	}
+	w.snapshot = makeInterfaceSnapshot(states)
+
+	if !w.opts.pollingOnly {
+		// Fallback to polling if failed.
+		if notifier, err := watchInterfaceChanges(w.changec); err == nil {
+			w.notifier = notifier
+		}
+	}
+	go w.run()
+	return w, nil
+}
+
+// Events returns the channel of events, it is closed after the watcher is closed.
+// The watcher stops detecting changes if the events are not consumed.
+func (w *InterfaceWatcher) Events() <-chan InterfaceEvent {
+	return w.events
+}
+
+// Close stops watching.
+func (w *InterfaceWatcher) Close() error {
+	err := ErrWatcherClosed
+	w.closeOnce.Do(func() {
+		close(w.closec)
+		if w.notifier != nil {
+			_ = w.notifier.Close()
+		}
+		<-w.donec
+		err = nil
+	})
+	return err
+}
+
+func (w *InterfaceWatcher) run() {
+	defer close(w.donec)
+	defer close(w.events)
+
+	var tickc <-chan time.Time
+	if w.opts.pollInterval > 0 {
+		ticker := time.NewTicker(w.opts.pollInterval)
+		defer ticker.Stop()
+		tickc = ticker.C
+	}
+	for {
+		select {
+		case <-w.changec:
+		case <-tickc:
+		case <-w.closec:
+			return
+		}
+
+		states, err := w.listInterfaces()
+		if err != nil {
+			continue // Try it next time.
+		}
+		snapshot := makeInterfaceSnapshot(states)
+		for _, event := range diffInterfaceSnapshots(w.snapshot, snapshot) {
+			select {
+			case w.events <- event:
+			case <-w.closec:
+				return
+			}
+		}
+		w.snapshot = snapshot
+	}
+}
+
+func listInterfaces() ([]interfaceState, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+	states := make([]interfaceState, 0, len(ifaces))
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, err
+		}
+		state := interfaceState{iface: iface}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				state.addrs = append(state.addrs, ipnet)
+			}
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+func makeInterfaceSnapshot(states []interfaceState) map[string]interfaceState {
+	snapshot := make(map[string]interfaceState, len(states))
+	for _, state := range states {
+		snapshot[state.iface.Name] = state
+	}
+	return snapshot
+}
+
+// diffInterfaceSnapshots returns the events in the order of interface names.
+func diffInterfaceSnapshots(prev, curr map[string]interfaceState) []InterfaceEvent {
+	names := make([]string, 0, len(prev)+len(curr))
+	for name := range prev {
+		names = append(names, name)
+	}
+	for name := range curr {
+		if _, ok := prev[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var events []InterfaceEvent
+	for _, name := range names {
+		p, inPrev := prev[name]
+		c, inCurr := curr[name]
+		switch {
+		case !inPrev:
+			events = append(events, InterfaceEvent{Type: InterfaceAdded, Interface: c.iface})
+			if c.iface.Flags&net.FlagUp != 0 {
+				events = append(events, InterfaceEvent{Type: InterfaceUp, Interface: c.iface})
+			}
+			events = appendAddressEvents(events, AddressAdded, c.iface, c.addrs, nil)
+		case !inCurr:
+			events = appendAddressEvents(events, AddressRemoved, p.iface, p.addrs, nil)
+			if p.iface.Flags&net.FlagUp != 0 {
+				events = append(events, InterfaceEvent{Type: InterfaceDown, Interface: p.iface})
+			}
+			events = append(events, InterfaceEvent{Type: InterfaceRemoved, Interface: p.iface})
+		default:
+			pup, cup := p.iface.Flags&net.FlagUp != 0, c.iface.Flags&net.FlagUp != 0
+			if !pup && cup {
+				events = append(events, InterfaceEvent{Type: InterfaceUp, Interface: c.iface})
+			}
+			events = appendAddressEvents(events, AddressRemoved, c.iface, p.addrs, c.addrs)
+			events = appendAddressEvents(events, AddressAdded, c.iface, c.addrs, p.addrs)
+			if pup && !cup {
+				events = append(events, InterfaceEvent{Type: InterfaceDown, Interface: c.iface})
+			}
+		}
+	}
+	return events
+}
+
+// appendAddressEvents appends the events of addresses in addrs but not in excluded.
+func appendAddressEvents(events []InterfaceEvent, typ InterfaceEventType, iface net.Interface,
+	addrs, excluded []*net.IPNet) []InterfaceEvent {
+	for _, addr := range addrs {
+		found := false
+		for _, x := range excluded {
+			if addr.String() == x.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			events = append(events, InterfaceEvent{Type: typ, Interface: iface, Addr: addr})
+		}
+	}
+	return events
+}
+
+// HostIPTracker keeps the current host IP updated on the interface changes,
+// it is useful to register the service with the right address. The current IP
+// is kept as long as it is available to avoid flapping.
+type HostIPTracker struct {
+	watcher *InterfaceWatcher
+	resolve func() ([]net.IP, error)
+
+	current atomic.Value
+	changes chan net.IP
+	donec   chan struct{}
+}
+
+// NewHostIPTracker creates a HostIPTracker which consumes the events of the
+// watcher, the IPs are resolved by ResolveHostIPs with the options.
+func NewHostIPTracker(watcher *InterfaceWatcher, opts ...WithResolveOption) *HostIPTracker {
+	return newHostIPTracker(watcher, func() ([]net.IP, error) {
+		return ResolveHostIPs(opts...)
+	})
+}
+
+func newHostIPTracker(watcher *InterfaceWatcher, resolve func() ([]net.IP, error)) *HostIPTracker {
+	t := &HostIPTracker{
+		watcher: watcher,
+		resolve: resolve,
+		changes: make(chan net.IP, 1),
+		donec:   make(chan struct{}),
+	}
+	t.current.Store(net.IP(nil))
+	t.update(false)
+	go t.run()
+	return t
+}
+
+// IP returns the current host IP, it is nil if no IP is available.
+func (t *HostIPTracker) IP() net.IP {
+	return t.current.Load().(net.IP)
+}
+
+// Changes returns the channel which receives the latest IP once it changes,
+// the stale values are dropped if not consumed in time.
+func (t *HostIPTracker) Changes() <-chan net.IP {
+	return t.changes
+}
+
+// Close closes the watcher and stops tracking.
+func (t *HostIPTracker) Close() error {
+	err := t.watcher.Close()
+	<-t.donec
+	return err
+}
+
+func (t *HostIPTracker) run() {
+	defer close(t.donec)
+	for range t.watcher.Events() {
+		// Coalesce the pending events.
+		for pending := true; pending; {
+			select {
+			case _, ok := <-t.watcher.Events():
+				pending = ok
+			default:
+				pending = false
+			}
+		}
+		t.update(true)
+	}
+}
+
+func (t *HostIPTracker) update(emit bool) {
+	current := t.IP()
+	ips, err := t.resolve()
+	var ip net.IP
+	if err == nil && len(ips) > 0 {
+		ip = ips[0]
+		for _, candidate := range ips {
+			if candidate.Equal(current) {
+				ip = current
+				break
+			}
+		}
+	}
+	if ip.Equal(current) {
+		return
+	}
+	t.current.Store(ip)
+	if !emit {
+		return
+	}
+	select { // Drop the stale one.
+	case <-t.changes:
+	default:
+	}
+	t.changes <- ip
+}
@@ -0,0 +1,52 @@
+//go:build linux
+// +build linux
+
+package net
+
+import (
+	"errors"
+	"io"
+	"os"
+	"syscall"
+)
+
+// The multicast groups of rtnetlink, see linux/rtnetlink.h.
+const (
+	rtmgrpLink       = 0x1
+	rtmgrpIPv4IfAddr = 0x10
+	rtmgrpIPv6IfAddr = 0x100
+)
+
+// watchInterfaceChanges subscribes the link and address changes via netlink, the
+// messages are not parsed since they only trigger the resynchronization.
+func watchInterfaceChanges(changec chan struct{}) (io.Closer, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC|syscall.SOCK_NONBLOCK,
+		syscall.NETLINK_ROUTE)
+	if err != nil {
+		return nil, os.NewSyscallError("socket", err)
+	}
+	sa := &syscall.SockaddrNetlink{
+		Family: syscall.AF_NETLINK,
+		Groups: rtmgrpLink | rtmgrpIPv4IfAddr | rtmgrpIPv6IfAddr,
+	}
+	if err := syscall.Bind(fd, sa); err != nil {
+		_ = syscall.Close(fd)
+		return nil, os.NewSyscallError("bind", err)
+	}
+
+	// The non-blocking fd is added to the runtime poller, so Close unblocks Read.
+	f := os.NewFile(uintptr(fd), "netlink")
+	go func() {
+		buf := make([]byte, os.Getpagesize())
+		for {
+			n, err := f.Read(buf)
+			if err != nil && !errors.Is(err, syscall.ENOBUFS) { // ENOBUFS: some messages are lost.
+				return
+			}
+			if n > 0 || err != nil {
+				notify(changec)
+			}
+		}
+	}()
+	return f, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package net
+
+import "io"
+
+func watchInterfaceChanges(chan struct{}) (io.Closer, error) {
+	return nil, errInterfaceNotifierNotSupported
+}
@@ -0,0 +1,152 @@
+package net
+
+import (
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func makeInterfaceState(name string, up bool, cidrs ...string) interfaceState {
+	state := interfaceState{iface: net.Interface{Name: name}}
+	if up {
+		state.iface.Flags |= net.FlagUp
+	}
+	for _, cidr := range cidrs {
+		ip, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		ipnet.IP = ip
+		state.addrs = append(state.addrs, ipnet)
+	}
+	return state
+}
+
+type fakeInterfaces struct {
+	mu     sync.Mutex
+	states []interfaceState
+}
+
+func (f *fakeInterfaces) set(states ...interfaceState) {
+	f.mu.Lock()
+	f.states = states
+	f.mu.Unlock()
+}
+
+func (f *fakeInterfaces) list() ([]interfaceState, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.states, nil
+}
+
+func TestDiffInterfaceSnapshots(t *testing.T) {
+	prev := makeInterfaceSnapshot([]interfaceState{
+		makeInterfaceState("eth0", true, "10.0.0.1/24"),
+		makeInterfaceState("eth1", true, "10.0.1.1/24"),
+		makeInterfaceState("wg0", true, "10.0.2.1/24"),
+	})
+	curr := makeInterfaceSnapshot([]interfaceState{
+		makeInterfaceState("eth0", true, "10.0.0.2/24"),
+		makeInterfaceState("eth1", false, "10.0.1.1/24"),
+		makeInterfaceState("tun0", true, "10.0.3.1/24"),
+	})
+
+	type event struct {
+		typ  InterfaceEventType
+		name string
+		addr string
+	}
+	var events []event
+	for _, e := range diffInterfaceSnapshots(prev, curr) {
+		addr := ""
+		if e.Addr != nil {
+			addr = e.Addr.String()
+		}
+		events = append(events, event{typ: e.Type, name: e.Interface.Name, addr: addr})
+	}
+	require.Equal(t, []event{
+		{AddressRemoved, "eth0", "10.0.0.1/24"},
+		{AddressAdded, "eth0", "10.0.0.2/24"},
+		{InterfaceDown, "eth1", ""},
+		{InterfaceAdded, "tun0", ""},
+		{InterfaceUp, "tun0", ""},
+		{AddressAdded, "tun0", "10.0.3.1/24"},
+		{AddressRemoved, "wg0", "10.0.2.1/24"},
+		{InterfaceDown, "wg0", ""},
+		{InterfaceRemoved, "wg0", ""},
+	}, events)
+	require.Equal(t, "InterfaceRemoved", InterfaceRemoved.String())
+	require.Empty(t, diffInterfaceSnapshots(curr, curr))
+}
+
+func TestInterfaceWatcher(t *testing.T) {
+	fake := &fakeInterfaces{}
+	fake.set(makeInterfaceState("eth0", true, "10.0.0.1/24"))
+	w, err := newInterfaceWatcher(fake.list, WithWatcherPollInterval(5*time.Millisecond), WithWatcherPollingOnly())
+	require.Nil(t, err)
+
+	fake.set(makeInterfaceState("eth0", true, "10.0.0.1/24", "10.0.0.2/24"))
+	e := <-w.Events()
+	require.Equal(t, AddressAdded, e.Type)
+	require.Equal(t, "eth0", e.Interface.Name)
+	require.Equal(t, "10.0.0.2/24", e.Addr.String())
+
+	fake.set(makeInterfaceState("eth0", false, "10.0.0.1/24", "10.0.0.2/24"))
+	e = <-w.Events()
+	require.Equal(t, InterfaceDown, e.Type)
+
+	require.Nil(t, w.Close())
+	require.Equal(t, ErrWatcherClosed, w.Close())
+	_, ok := <-w.Events()
+	require.False(t, ok)
+
+	// The real one.
+	w, err = NewInterfaceWatcher()
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+}
+
+func TestHostIPTracker(t *testing.T) {
+	fake := &fakeInterfaces{}
+	fake.set(makeInterfaceState("eth0", true, "10.0.0.1/24"))
+	w, err := newInterfaceWatcher(fake.list, WithWatcherPollInterval(5*time.Millisecond), WithWatcherPollingOnly())
+	require.Nil(t, err)
+
+	var mu sync.Mutex
+	ips := []net.IP{net.ParseIP("10.0.0.1")}
+	tracker := newHostIPTracker(w, func() ([]net.IP, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(ips) == 0 {
+			return nil, ErrNoAvailableIPAddress
+		}
+		return ips, nil
+	})
+	defer tracker.Close()
+	require.Equal(t, "10.0.0.1", tracker.IP().String())
+
+	// The current IP is kept if it is still available.
+	mu.Lock()
+	ips = []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1")}
+	mu.Unlock()
+	fake.set(makeInterfaceState("eth0", true, "10.0.0.1/24", "10.0.0.2/24"))
+	time.Sleep(30 * time.Millisecond)
+	require.Equal(t, "10.0.0.1", tracker.IP().String())
+
+	mu.Lock()
+	ips = []net.IP{net.ParseIP("10.0.0.2")}
+	mu.Unlock()
+	fake.set(makeInterfaceState("eth0", true, "10.0.0.2/24"))
+	require.Equal(t, "10.0.0.2", (<-tracker.Changes()).String())
+	require.Equal(t, "10.0.0.2", tracker.IP().String())
+
+	mu.Lock()
+	ips = nil
+	mu.Unlock()
+	fake.set(makeInterfaceState("eth0", false, "10.0.0.2/24"))
+	require.Nil(t, <-tracker.Changes())
+	require.Nil(t, tracker.IP())
+}
@@ -3,6 +3,8 @@ package net
 import (
 	"errors"
 	"net"
+	"path"
+	"sort"
 )
 
 var (
@@ -14,10 +16,187 @@ var (
 // interface, the empty interfaceName means all network interfaces,
 // only up interfaces will be checked.
 func ResolveHostIP(interfaceName string) (net.IP, error) {
-	ifaces, err := net.Interfaces()
+	var hostIP net.IP
+	err := iterateHostIPs(interfaceName, func(_ net.Interface, ip net.IP) bool {
+		hostIP = ip
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+	if hostIP == nil {
+		return nil, ErrNoAvailableIPAddress
+	}
+	return hostIP, nil
+}
+
+// IPFamily represents the IP address family.
+type IPFamily int
+
+const (
+	IPFamilyAny IPFamily = iota
+	IPv4
+	IPv6
+)
+
+func ipFamilyOf(ip net.IP) IPFamily {
+	if ip.To4() != nil {
+		return IPv4
+	}
+	return IPv6
+}
+
+type (
+	ResolveOptions struct {
+		interfaceName     string
+		preferredFamily   IPFamily
+		excludeLinkLocal  bool
+		privateOnly       bool
+		allowedCIDRs      []*net.IPNet
+		deniedCIDRs       []*net.IPNet
+		skippedInterfaces []string
+	}
+	WithResolveOption func(opts *ResolveOptions)
+)
+
+// WithInterfaceName only checks the given network interface.
+func WithInterfaceName(interfaceName string) WithResolveOption {
+	return func(opts *ResolveOptions) {
+		opts.interfaceName = interfaceName
+	}
+}
+
+// WithPreferredIPFamily ranks the addresses of the family first.
+func WithPreferredIPFamily(family IPFamily) WithResolveOption {
+	return func(opts *ResolveOptions) {
+		opts.preferredFamily = family
+	}
+}
+
+// WithoutLinkLocal excludes link-local addresses (169.254.0.0/16 and fe80::/10).
+func WithoutLinkLocal() WithResolveOption {
+	return func(opts *ResolveOptions) {
+		opts.excludeLinkLocal = true
+	}
+}
+
+// WithPrivateOnly only accepts RFC 1918 IPv4 addresses and RFC 4193 IPv6
+// unique local addresses.
+func WithPrivateOnly() WithResolveOption {
+	return func(opts *ResolveOptions) {
+		opts.privateOnly = true
+	}
+}
+
+// WithAllowedCIDRs only accepts addresses within the given networks.
+func WithAllowedCIDRs(cidrs ...*net.IPNet) WithResolveOption {
+	return func(opts *ResolveOptions) {
+		opts.allowedCIDRs = append(opts.allowedCIDRs, cidrs...)
+	}
+}
+
+// WithDeniedCIDRs excludes addresses within the given networks.
+func WithDeniedCIDRs(cidrs ...*net.IPNet) WithResolveOption {
+	return func(opts *ResolveOptions) {
+		opts.deniedCIDRs = append(opts.deniedCIDRs, cidrs...)
+	}
+}
+
+// WithSkippedInterfaces skips the network interfaces whose name matches any of the
+// patterns, e.g. "docker*" and "veth*", the pattern syntax is the same as path.Match.
+func WithSkippedInterfaces(patterns ...string) WithResolveOption {
+	return func(opts *ResolveOptions) {
+		opts.skippedInterfaces = append(opts.skippedInterfaces, patterns...)
+	}
+}
+
+func makeResolveOptions(opts ...WithResolveOption) ResolveOptions {
+	var resolveOpts ResolveOptions
+	for _, opt := range opts {
+		opt(&resolveOpts)
+	}
+	return resolveOpts
+}
+
+func (opts *ResolveOptions) skipInterface(name string) bool {
+	for _, pattern := range opts.skippedInterfaces {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (opts *ResolveOptions) accept(ip net.IP) bool {
+	if opts.excludeLinkLocal && ip.IsLinkLocalUnicast() {
+		return false
+	}
+	if opts.privateOnly && !isPrivateIP(ip) {
+		return false
+	}
+	for _, cidr := range opts.deniedCIDRs {
+		if cidr.Contains(ip) {
+			return false
+		}
+	}
+	if len(opts.allowedCIDRs) == 0 {
+		return true
+	}
+	for _, cidr := range opts.allowedCIDRs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// rank sorts the addresses stably: the preferred family first, then the global
+// unicast addresses before the link-local ones.
+func (opts *ResolveOptions) rank(ips []net.IP) {
+	score := func(ip net.IP) int {
+		s := 0
+		if opts.preferredFamily != IPFamilyAny && ipFamilyOf(ip) != opts.preferredFamily {
+			s += 2
+		}
+		if ip.IsLinkLocalUnicast() {
+			s++
+		}
+		return s
+	}
+	sort.SliceStable(ips, func(i, j int) bool {
+		return score(ips[i]) < score(ips[j])
+	})
+}
+
+// ResolveHostIPs returns all the non-loopback IPs of the up network interfaces
+// which are accepted by the options, the addresses are ranked by preference
+// and the first one is the best candidate.
+func ResolveHostIPs(opts ...WithResolveOption) ([]net.IP, error) {
+	resolveOpts := makeResolveOptions(opts...)
+	var ips []net.IP
+	err := iterateHostIPs(resolveOpts.interfaceName, func(iface net.Interface, ip net.IP) bool {
+		if !resolveOpts.skipInterface(iface.Name) && resolveOpts.accept(ip) {
+			ips = append(ips, ip)
+		}
+		return true
+	})
 	if err != nil {
 		return nil, err
 	}
+	if len(ips) == 0 {
+		return nil, ErrNoAvailableIPAddress
+	}
+	resolveOpts.rank(ips)
+	return ips, nil
+}
+
+// iterateHostIPs iterates over the non-loopback IPs of the up network interfaces,
+// it stops if the visit returns false.
+func iterateHostIPs(interfaceName string, visit func(net.Interface, net.IP) bool) error {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return err
+	}
 
 	interfaceFound := false
 	for _, iface := range ifaces {
@@ -33,7 +212,7 @@ func ResolveHostIP(interfaceName string) (net.IP, error) {
 		}
 		addrs, err := iface.Addrs()
 		if err != nil {
-			return nil, err
+			return err
 		}
 		for _, addr := range addrs {
 			var ip net.IP
@@ -46,12 +225,38 @@ func ResolveHostIP(interfaceName string) (net.IP, error) {
 			if ip.IsLoopback() || (ip.To4() == nil && ip.To16() == nil) {
 				continue
 			}
-			return ip, nil
+			if !visit(iface, ip) {
+				return nil
+			}
 		}
 	}
 
 	if !interfaceFound {
-		return nil, ErrNetworkInterfaceNotFound
+		return ErrNetworkInterfaceNotFound
+	}
+	return nil
+}
+
+var _privateIPNets = []*net.IPNet{ //nolint:gochecknoglobals
+	mustParseCIDR("10.0.0.0/8"),
+	mustParseCIDR("172.16.0.0/12"),
+	mustParseCIDR("192.168.0.0/16"),
+	mustParseCIDR("fc00::/7"),
+}
+
+func isPrivateIP(ip net.IP) bool {
+	for _, ipnet := range _privateIPNets {
+		if ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, ipnet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
 	}
-	return nil, ErrNoAvailableIPAddress
+	return ipnet
 }
@@ -1,6 +1,7 @@
 package net
 
 import (
+	"net"
 	"os"
 	"testing"
 
@@ -21,3 +22,71 @@ func TestResolveHostIP(t *testing.T) {
 	require.NotNil(t, ip)
 	t.Logf("HostIP: %s", ip)
 }
+
+func TestResolveHostIPs(t *testing.T) {
+	_, err := ResolveHostIPs(WithInterfaceName("interface-not-found"))
+	require.Equal(t, ErrNetworkInterfaceNotFound, err)
+
+	if os.Getenv("SKIP_TestResolveHostIP_IPLOOKUP") != "" {
+		t.Skip("skip ip address lookup")
+	}
+	ips, err := ResolveHostIPs()
+	require.Nil(t, err)
+	ip, err := ResolveHostIP("")
+	require.Nil(t, err)
+	require.Contains(t, ips, ip)
+	t.Logf("HostIPs: %v", ips)
+}
+
+func TestResolveOptions(t *testing.T) {
+	opts := makeResolveOptions(
+		WithoutLinkLocal(),
+		WithPrivateOnly(),
+		WithDeniedCIDRs(mustParseCIDR("172.17.0.0/16")),
+		WithSkippedInterfaces("docker*", "veth*"),
+	)
+	for ipstr, accepted := range map[string]bool{
+		"10.0.0.1":    true,
+		"172.16.0.1":  true,
+		"172.17.0.1":  false,
+		"192.168.1.1": true,
+		"8.8.8.8":     false,
+		"169.254.1.1": false,
+		"fe80::1":     false,
+		"fd00::1":     true,
+		"2001:db8::1": false,
+	} {
+		require.Equal(t, accepted, opts.accept(net.ParseIP(ipstr)), ipstr)
+	}
+	require.True(t, opts.skipInterface("docker0"))
+	require.True(t, opts.skipInterface("veth1234"))
+	require.False(t, opts.skipInterface("eth0"))
+
+	opts = makeResolveOptions(WithAllowedCIDRs(mustParseCIDR("192.168.0.0/16"), mustParseCIDR("2001:db8::/32")))
+	require.True(t, opts.accept(net.ParseIP("192.168.3.4")))
+	require.True(t, opts.accept(net.ParseIP("2001:db8::1")))
+	require.False(t, opts.accept(net.ParseIP("10.0.0.1")))
+}
+
+func TestResolveOptions_Rank(t *testing.T) {
+	parseIPs := func(ipstrs ...string) []net.IP {
+		ips := make([]net.IP, 0, len(ipstrs))
+		for _, s := range ipstrs {
+			ips = append(ips, net.ParseIP(s))
+		}
+		return ips
+	}
+
+	ips := parseIPs("fe80::1", "169.254.0.1", "2001:db8::1", "10.0.0.1", "10.0.0.2")
+	opts := makeResolveOptions()
+	opts.rank(ips)
+	require.Equal(t, parseIPs("2001:db8::1", "10.0.0.1", "10.0.0.2", "fe80::1", "169.254.0.1"), ips)
+
+	opts = makeResolveOptions(WithPreferredIPFamily(IPv4))
+	opts.rank(ips)
+	require.Equal(t, parseIPs("10.0.0.1", "10.0.0.2", "169.254.0.1", "2001:db8::1", "fe80::1"), ips)
+
+	opts = makeResolveOptions(WithPreferredIPFamily(IPv6))
+	opts.rank(ips)
+	require.Equal(t, parseIPs("2001:db8::1", "fe80::1", "10.0.0.1", "10.0.0.2", "169.254.0.1"), ips)
+}
@@ -0,0 +1,374 @@
+package net
+
+import (
+	"errors"
+	"net"
+	"strings"
+)
+
+var (
+	ErrInvalidIP      = errors.New("libext-go/net: invalid IP address")
+	ErrInvalidIPRange = errors.New("libext-go/net: invalid IP range")
+)
+
+// IPSet is a set of IPv4 and IPv6 addresses, the addresses are stored as
+// prefixes in radix tries, adjacent prefixes are merged automatically.
+// It is not thread-safe, but concurrent lookups without modifications are fine.
+type IPSet struct {
+	v4 *ipTrieNode
+	v6 *ipTrieNode
+}
+
+// NewIPSet creates a new empty IPSet.
+func NewIPSet() *IPSet {
+	return &IPSet{
+		v4: &ipTrieNode{},
+		v6: &ipTrieNode{},
+	}
+}
+
+// ParseIPSet creates a new IPSet from a list of CIDRs or IPs, e.g. "10.0.0.0/8" and "::1".
+func ParseIPSet(cidrs ...string) (*IPSet, error) {
+	s := NewIPSet()
+	for _, cidr := range cidrs {
+		if err := s.AddCIDR(cidr); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// AddCIDR adds a CIDR or an IP into the set.
+func (s *IPSet) AddCIDR(cidr string) error {
+	ipnet, err := parseCIDROrIP(cidr)
+	if err != nil {
+		return err
+	}
+	s.Add(ipnet)
+	return nil
+}
+
+// RemoveCIDR removes a CIDR or an IP from the set.
+func (s *IPSet) RemoveCIDR(cidr string) error {
+	ipnet, err := parseCIDROrIP(cidr)
+	if err != nil {
+		return err
+	}
+	s.Remove(ipnet)
+	return nil
+}
+
+func parseCIDROrIP(cidr string) (*net.IPNet, error) {
+	if strings.IndexByte(cidr, '/') < 0 {
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			return nil, ErrInvalidIP
+		}
+		return ipToIPNet(ip), nil
+	}
+	_, ipnet, err := net.ParseCIDR(cidr)
+	return ipnet, err
+}
+
+func ipToIPNet(ip net.IP) *net.IPNet {
+	if v4 := ip.To4(); v4 != nil {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(32, 32)}
+	}
+	return &net.IPNet{IP: ip.To16(), Mask: net.CIDRMask(128, 128)}
+}
+
+// Add adds all addresses of the ipnet into the set.
+func (s *IPSet) Add(ipnet *net.IPNet) {
+	if root, ip, ones, ok := s.locate(ipnet); ok {
+		root.add(ip, 0, ones)
+	}
+}
+
+// Remove removes all addresses of the ipnet from the set.
+func (s *IPSet) Remove(ipnet *net.IPNet) {
+	if root, ip, ones, ok := s.locate(ipnet); ok {
+		root.remove(ip, 0, ones)
+	}
+}
+
+// AddIP adds the ip into the set.
+func (s *IPSet) AddIP(ip net.IP) {
+	s.Add(ipToIPNet(ip))
+}
+
+// RemoveIP removes the ip from the set.
+func (s *IPSet) RemoveIP(ip net.IP) {
+	s.Remove(ipToIPNet(ip))
+}
+
+// AddRange adds all addresses within [first, last] into the set.
+func (s *IPSet) AddRange(first, last net.IP) error {
+	ipnets, err := RangeToCIDRs(first, last)
+	if err != nil {
+		return err
+	}
+	for _, ipnet := range ipnets {
+		s.Add(ipnet)
+	}
+	return nil
+}
+
+func (s *IPSet) locate(ipnet *net.IPNet) (*ipTrieNode, net.IP, int, bool) {
+	ones, bits := ipnet.Mask.Size()
+	if bits == 0 {
+		return nil, nil, 0, false // Non-canonical mask.
+	}
+	ip := ipnet.IP.Mask(ipnet.Mask)
+	if ip == nil {
+		return nil, nil, 0, false
+	}
+	if v4 := ip.To4(); v4 != nil {
+		if bits == 8*net.IPv6len { // IPv4-mapped IPv6 prefix.
+			ones -= 8 * (net.IPv6len - net.IPv4len)
+			if ones < 0 {
+				return nil, nil, 0, false
+			}
+		}
+		return s.v4, v4, ones, true
+	}
+	return s.v6, ip.To16(), ones, true
+}
+
+// Contains reports whether the ip is in the set.
+func (s *IPSet) Contains(ip net.IP) bool {
+	if v4 := ip.To4(); v4 != nil {
+		return s.v4.contains(v4)
+	}
+	if v6 := ip.To16(); v6 != nil {
+		return s.v6.contains(v6)
+	}
+	return false
+}
+
+// IsEmpty reports whether the set contains nothing.
+func (s *IPSet) IsEmpty() bool {
+	return s.v4.isEmpty() && s.v6.isEmpty()
+}
+
+// CIDRs returns the minimal list of prefixes covering the set,
+// IPv4 prefixes go first and the prefixes are sorted by address.
+func (s *IPSet) CIDRs() []*net.IPNet {
+	var ipnets []*net.IPNet
+	ipnets = s.v4.collect(make(net.IP, net.IPv4len), 0, ipnets)
+	ipnets = s.v6.collect(make(net.IP, net.IPv6len), 0, ipnets)
+	return ipnets
+}
+
+func (s *IPSet) String() string {
+	ipnets := s.CIDRs()
+	strs := make([]string, 0, len(ipnets))
+	for _, ipnet := range ipnets {
+		strs = append(strs, ipnet.String())
+	}
+	return "[" + strings.Join(strs, " ") + "]"
+}
+
+// ipTrieNode is a node of the binary radix trie, the full means all addresses
+// under the prefix of the node are in the set, so it has no children.
+type ipTrieNode struct {
+	children [2]*ipTrieNode
+	full     bool
+}
+
+func (n *ipTrieNode) isEmpty() bool {
+	return !n.full && n.children[0] == nil && n.children[1] == nil
+}
+
+func (n *ipTrieNode) add(ip net.IP, depth, ones int) {
+	if n.full {
+		return
+	}
+	if depth == ones {
+		n.full = true
+		n.children = [2]*ipTrieNode{}
+		return
+	}
+
+	b := ipBitAt(ip, depth)
+	if n.children[b] == nil {
+		n.children[b] = &ipTrieNode{}
+	}
+	n.children[b].add(ip, depth+1, ones)
+	if c0, c1 := n.children[0], n.children[1]; c0 != nil && c1 != nil && c0.full && c1.full {
+		n.full = true // Merge.
+		n.children = [2]*ipTrieNode{}
+	}
+}
+
+func (n *ipTrieNode) remove(ip net.IP, depth, ones int) {
+	if depth == ones {
+		*n = ipTrieNode{}
+		return
+	}
+	if n.full { // Split.
+		n.full = false
+		n.children = [2]*ipTrieNode{{full: true}, {full: true}}
+	}
+
+	b := ipBitAt(ip, depth)
+	child := n.children[b]
+	if child == nil {
+		return
+	}
+	child.remove(ip, depth+1, ones)
+	if child.isEmpty() {
+		n.children[b] = nil
+	}
+}
+
+func (n *ipTrieNode) contains(ip net.IP) bool {
+	bits := len(ip) * 8
+	for depth := 0; n != nil; depth++ {
+		if n.full {
+			return true
+		}
+		if depth == bits {
+			break
+		}
+		n = n.children[ipBitAt(ip, depth)]
+	}
+	return false
+}
+
+func (n *ipTrieNode) collect(prefix net.IP, depth int, ipnets []*net.IPNet) []*net.IPNet {
+	if n.full {
+		ip := make(net.IP, len(prefix))
+		copy(ip, prefix)
+		return append(ipnets, &net.IPNet{IP: ip, Mask: net.CIDRMask(depth, len(prefix)*8)})
+	}
+	for b, child := range n.children {
+		if child == nil {
+			continue
+		}
+		setIPBit(prefix, depth, b)
+		ipnets = child.collect(prefix, depth+1, ipnets)
+		setIPBit(prefix, depth, 0)
+	}
+	return ipnets
+}
+
+func ipBitAt(ip net.IP, i int) int {
+	return int(ip[i/8]>>(7-uint(i%8))) & 1
+}
+
+func setIPBit(ip net.IP, i, b int) {
+	mask := byte(1) << (7 - uint(i%8))
+	if b == 0 {
+		ip[i/8] &^= mask
+	} else {
+		ip[i/8] |= mask
+	}
+}
+
+// NextIP returns the IP next to the given one, it returns nil on overflow.
+func NextIP(ip net.IP) net.IP {
+	next := normalizeIP(ip)
+	if next == nil {
+		return nil
+	}
+	next = append(net.IP(nil), next...)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			return next
+		}
+	}
+	return nil
+}
+
+// PrevIP returns the IP previous to the given one, it returns nil on underflow.
+func PrevIP(ip net.IP) net.IP {
+	prev := normalizeIP(ip)
+	if prev == nil {
+		return nil
+	}
+	prev = append(net.IP(nil), prev...)
+	for i := len(prev) - 1; i >= 0; i-- {
+		prev[i]--
+		if prev[i] != 0xff {
+			return prev
+		}
+	}
+	return nil
+}
+
+// IterateIPNet iterates over all addresses of the ipnet in order,
+// it stops if the ipIterator returns false.
+func IterateIPNet(ipnet *net.IPNet, ipIterator func(ip net.IP) bool) {
+	ip := normalizeIP(ipnet.IP.Mask(ipnet.Mask))
+	for ip != nil && ipnet.Contains(ip) {
+		if !ipIterator(ip) {
+			return
+		}
+		ip = NextIP(ip)
+	}
+}
+
+// RangeToCIDRs converts the range [first, last] into the minimal list of prefixes.
+func RangeToCIDRs(first, last net.IP) ([]*net.IPNet, error) {
+	first, last = normalizeIP(first), normalizeIP(last)
+	if first == nil || last == nil || len(first) != len(last) || compareIP(first, last) > 0 {
+		return nil, ErrInvalidIPRange
+	}
+
+	first = append(net.IP(nil), first...)
+	bits := len(first) * 8
+	var ipnets []*net.IPNet
+	for first != nil && compareIP(first, last) <= 0 {
+		ones := bits - trailingZeroBits(first)
+		for ones < bits && compareIP(lastIPOfPrefix(first, ones), last) > 0 {
+			ones++
+		}
+		ipnets = append(ipnets, &net.IPNet{IP: first, Mask: net.CIDRMask(ones, bits)})
+		first = NextIP(lastIPOfPrefix(first, ones))
+	}
+	return ipnets, nil
+}
+
+func normalizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	}
+	return ip.To16()
+}
+
+func compareIP(a, b net.IP) int {
+	for i := range a {
+		if a[i] != b[i] {
+			if a[i] < b[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func trailingZeroBits(ip net.IP) int {
+	n := 0
+	for i := len(ip) - 1; i >= 0; i-- {
+		if ip[i] == 0 {
+			n += 8
+			continue
+		}
+		for b := ip[i]; b&1 == 0; b >>= 1 {
+			n++
+		}
+		break
+	}
+	return n
+}
+
+func lastIPOfPrefix(ip net.IP, ones int) net.IP {
+	last := make(net.IP, len(ip))
+	mask := net.CIDRMask(ones, len(ip)*8)
+	for i := range ip {
+		last[i] = ip[i] | ^mask[i]
+	}
+	return last
+}
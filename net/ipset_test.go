@@ -0,0 +1,127 @@
+package net
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestIPSet(t *testing.T) {
+	s, err := ParseIPSet("10.0.0.0/8", "192.168.1.0/24", "192.168.0.0/24", "2001:db8::/32", "::1")
+	require.Nil(t, err)
+	require.Equal(t, "[10.0.0.0/8 192.168.0.0/23 ::1/128 2001:db8::/32]", s.String())
+
+	for ipstr, contained := range map[string]bool{
+		"10.1.2.3":         true,
+		"11.0.0.0":         false,
+		"192.168.0.255":    true,
+		"192.168.1.1":      true,
+		"192.168.2.1":      false,
+		"::ffff:10.0.0.1":  true,
+		"::1":              true,
+		"::2":              false,
+		"2001:db8:1::1":    true,
+		"2001:db9::1":      false,
+		"0.0.0.0":          false,
+		"255.255.255.255":  false,
+		"ffff::ffff:ffff":  false,
+		"2001:db8:ffff::1": true,
+	} {
+		require.Equal(t, contained, s.Contains(net.ParseIP(ipstr)), ipstr)
+	}
+	require.False(t, s.Contains(nil))
+
+	require.Nil(t, s.RemoveCIDR("10.128.0.0/9"))
+	require.Nil(t, s.RemoveCIDR("10.0.0.1"))
+	require.Nil(t, s.RemoveCIDR("192.168.0.0/16"))
+	require.Nil(t, s.RemoveCIDR("2001:db8::/32"))
+	require.Equal(t, "[10.0.0.0/32 10.0.0.2/31 10.0.0.4/30 10.0.0.8/29 10.0.0.16/28 10.0.0.32/27 "+
+		"10.0.0.64/26 10.0.0.128/25 10.0.1.0/24 10.0.2.0/23 10.0.4.0/22 10.0.8.0/21 10.0.16.0/20 "+
+		"10.0.32.0/19 10.0.64.0/18 10.0.128.0/17 10.1.0.0/16 10.2.0.0/15 10.4.0.0/14 10.8.0.0/13 "+
+		"10.16.0.0/12 10.32.0.0/11 10.64.0.0/10 ::1/128]", s.String())
+	require.False(t, s.Contains(net.ParseIP("10.0.0.1")))
+	require.False(t, s.Contains(net.ParseIP("10.200.0.1")))
+	require.True(t, s.Contains(net.ParseIP("10.0.0.2")))
+
+	s.AddIP(net.ParseIP("10.0.0.1"))
+	require.Nil(t, s.AddCIDR("10.128.0.0/9"))
+	s.RemoveIP(net.ParseIP("::1"))
+	require.Equal(t, "[10.0.0.0/8]", s.String())
+	require.Nil(t, s.RemoveCIDR("0.0.0.0/0"))
+	require.True(t, s.IsEmpty())
+
+	require.NotNil(t, s.AddCIDR("10.0.0.0/33"))
+	require.Equal(t, ErrInvalidIP, s.AddCIDR("10.0.0.256"))
+}
+
+func TestRangeToCIDRs(t *testing.T) {
+	for _, c := range []struct {
+		first, last string
+		expected    []string
+	}{
+		{"10.0.0.0", "10.0.0.0", []string{"10.0.0.0/32"}},
+		{"10.0.0.0", "10.0.0.255", []string{"10.0.0.0/24"}},
+		{"10.0.0.1", "10.0.0.6", []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"}},
+		{"0.0.0.0", "255.255.255.255", []string{"0.0.0.0/0"}},
+		{"255.255.255.254", "255.255.255.255", []string{"255.255.255.254/31"}},
+		{"::", "::3", []string{"::/126"}},
+		{"2001:db8::ffff", "2001:db8::1:0", []string{"2001:db8::ffff/128", "2001:db8::1:0/128"}},
+	} {
+		ipnets, err := RangeToCIDRs(net.ParseIP(c.first), net.ParseIP(c.last))
+		require.Nil(t, err)
+		actual := make([]string, 0, len(ipnets))
+		for _, ipnet := range ipnets {
+			actual = append(actual, ipnet.String())
+		}
+		require.Equal(t, c.expected, actual, c.first+"-"+c.last)
+	}
+
+	_, err := RangeToCIDRs(net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1"))
+	require.Equal(t, ErrInvalidIPRange, err)
+	_, err = RangeToCIDRs(net.ParseIP("10.0.0.2"), net.ParseIP("::1"))
+	require.Equal(t, ErrInvalidIPRange, err)
+
+	s := NewIPSet()
+	require.Nil(t, s.AddRange(net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.6")))
+	require.Equal(t, "[10.0.0.1/32 10.0.0.2/31 10.0.0.4/31 10.0.0.6/32]", s.String())
+}
+
+func TestNextPrevIP(t *testing.T) {
+	require.Equal(t, "10.0.1.0", NextIP(net.ParseIP("10.0.0.255")).String())
+	require.Equal(t, "10.0.0.255", PrevIP(net.ParseIP("10.0.1.0")).String())
+	require.Equal(t, "::1:0", NextIP(net.ParseIP("::ffff")).String())
+	require.Equal(t, "::ffff", PrevIP(net.ParseIP("::1:0")).String())
+	require.Nil(t, NextIP(net.ParseIP("255.255.255.255")))
+	require.Nil(t, PrevIP(net.ParseIP("0.0.0.0")))
+	require.Nil(t, NextIP(net.ParseIP("ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff")))
+	require.Nil(t, PrevIP(net.ParseIP("::")))
+	require.Nil(t, NextIP(nil))
+
+	ip := net.ParseIP("10.0.0.1")
+	_ = NextIP(ip)
+	require.Equal(t, "10.0.0.1", ip.String())
+}
+
+func TestIterateIPNet(t *testing.T) {
+	var ips []string
+	IterateIPNet(mustParseCIDR("10.0.0.5/30"), func(ip net.IP) bool {
+		ips = append(ips, ip.String())
+		return true
+	})
+	require.Equal(t, []string{"10.0.0.4", "10.0.0.5", "10.0.0.6", "10.0.0.7"}, ips)
+
+	ips = ips[:0]
+	IterateIPNet(mustParseCIDR("ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe/127"), func(ip net.IP) bool {
+		ips = append(ips, ip.String())
+		return true
+	})
+	require.Equal(t, []string{"ffff:ffff:ffff:ffff:ffff:ffff:ffff:fffe", "ffff:ffff:ffff:ffff:ffff:ffff:ffff:ffff"}, ips)
+
+	n := 0
+	IterateIPNet(mustParseCIDR("10.0.0.0/8"), func(net.IP) bool {
+		n++
+		return n < 3
+	})
+	require.Equal(t, 3, n)
+}
@@ -0,0 +1,422 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+var (
+	ErrUnreachableAddress = errors.New("libext-go/net: unreachable address")
+)
+
+const (
+	memNetwork                = "mem"
+	defaultMemPipeBufferSize  = 64 * 1024
+	defaultMemPacketQueueSize = 128
+)
+
+// MemAddr is the address of the in-memory connections.
+type MemAddr string
+
+func (a MemAddr) Network() string { return memNetwork }
+func (a MemAddr) String() string  { return string(a) }
+
+type (
+	MemPipeOptions struct {
+		bufferSize int
+	}
+	WithMemPipeOption func(opts *MemPipeOptions)
+)
+
+// WithMemPipeBufferSize sets the buffer size of each direction of the pipe,
+// the writes block if the buffer is full.
+func WithMemPipeBufferSize(size int) WithMemPipeOption {
+	return func(opts *MemPipeOptions) {
+		if size <= 0 {
+			size = 1
+		}
+		opts.bufferSize = size
+	}
+}
+
+var _defaultMemPipeOptions = []WithMemPipeOption{
+	WithMemPipeBufferSize(defaultMemPipeBufferSize),
+}
+
+func makeMemPipeOptions(opts ...WithMemPipeOption) MemPipeOptions {
+	var pipeOpts MemPipeOptions
+	for _, opt := range _defaultMemPipeOptions {
+		opt(&pipeOpts)
+	}
+	for _, opt := range opts {
+		opt(&pipeOpts)
+	}
+	return pipeOpts
+}
+
+// MemListener is an in-memory net.Listener, the connections are created by Dial,
+// it is useful to test the handlers of NewServerFromListener without binding ports.
+type MemListener struct {
+	addr    MemAddr
+	opts    MemPipeOptions
+	dialSeq *atomic.Uint64
+
+	connc     chan net.Conn
+	closec    chan struct{}
+	closeOnce sync.Once
+}
+
+// NewMemListener creates a MemListener with the name as its address.
+func NewMemListener(name string, opts ...WithMemPipeOption) *MemListener {
+	return &MemListener{
+		addr:    MemAddr(name),
+		opts:    makeMemPipeOptions(opts...),
+		dialSeq: atomic.NewUint64(0),
+		connc:   make(chan net.Conn),
+		closec:  make(chan struct{}),
+	}
+}
+
+// Dial connects to the listener, it blocks until the connection is accepted.
+func (l *MemListener) Dial() (net.Conn, error) {
+	return l.DialContext(context.Background())
+}
+
+// DialContext is the same as Dial with a context.
+func (l *MemListener) DialContext(ctx context.Context) (net.Conn, error) {
+	caddr := MemAddr(string(l.addr) + "-client-" + strconv.FormatUint(l.dialSeq.Inc(), 10))
+	cconn, sconn := newMemPipe(caddr, l.addr, l.opts)
+	select {
+	case l.connc <- sconn:
+		return cconn, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-l.closec:
+		return nil, ErrListenerClosed
+	}
+}
+
+func (l *MemListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connc:
+		return conn, nil
+	case <-l.closec:
+		return nil, ErrListenerClosed
+	}
+}
+
+func (l *MemListener) Close() error {
+	err := ErrListenerClosed
+	l.closeOnce.Do(func() {
+		close(l.closec)
+		err = nil
+	})
+	return err
+}
+
+func (l *MemListener) Addr() net.Addr {
+	return l.addr
+}
+
+// MemPipe creates a buffered in-memory full duplex connection, unlike the net.Pipe,
+// the writes return once the data is buffered.
+func MemPipe(opts ...WithMemPipeOption) (net.Conn, net.Conn) {
+	return newMemPipe(MemAddr("pipe"), MemAddr("pipe"), makeMemPipeOptions(opts...))
+}
+
+func newMemPipe(addr1, addr2 MemAddr, opts MemPipeOptions) (*memConn, *memConn) {
+	s1 := newMemStream(opts.bufferSize)
+	s2 := newMemStream(opts.bufferSize)
+	c1 := newMemConn(addr1, addr2, s1, s2)
+	c2 := newMemConn(addr2, addr1, s2, s1)
+	return c1, c2
+}
+
+// memStream is one direction of the pipe.
+type memStream struct {
+	mu       sync.Mutex
+	buf      bytes.Buffer
+	size     int
+	rclosed  bool
+	wclosed  bool
+	readable chan struct{}
+	writable chan struct{}
+}
+
+func newMemStream(size int) *memStream {
+	return &memStream{
+		size:     size,
+		readable: make(chan struct{}, 1),
+		writable: make(chan struct{}, 1),
+	}
+}
+
+func (s *memStream) closeRead() {
+	s.mu.Lock()
+	s.rclosed = true
+	s.buf.Reset()
+	s.mu.Unlock()
+	notify(s.writable)
+}
+
+func (s *memStream) closeWrite() {
+	s.mu.Lock()
+	s.wclosed = true
+	s.mu.Unlock()
+	notify(s.readable)
+}
+
+func notify(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+type memConn struct {
+	laddr, raddr MemAddr
+	r, w         *memStream
+
+	readDeadline  pipeDeadline
+	writeDeadline pipeDeadline
+	closec        chan struct{}
+	closeOnce     sync.Once
+}
+
+func newMemConn(laddr, raddr MemAddr, r, w *memStream) *memConn {
+	return &memConn{
+		laddr:         laddr,
+		raddr:         raddr,
+		r:             r,
+		w:             w,
+		readDeadline:  makePipeDeadline(),
+		writeDeadline: makePipeDeadline(),
+		closec:        make(chan struct{}),
+	}
+}
+
+func (c *memConn) Read(p []byte) (int, error) {
+	for {
+		switch {
+		case isClosedChan(c.closec):
+			return 0, io.ErrClosedPipe
+		case isClosedChan(c.readDeadline.wait()):
+			return 0, errTimeout
+		}
+
+		s := c.r
+		s.mu.Lock()
+		if s.buf.Len() > 0 {
+			n, _ := s.buf.Read(p)
+			s.mu.Unlock()
+			notify(s.writable)
+			return n, nil
+		}
+		wclosed := s.wclosed
+		s.mu.Unlock()
+		if wclosed {
+			return 0, io.EOF
+		}
+		if len(p) == 0 {
+			return 0, nil
+		}
+
+		select {
+		case <-s.readable:
+		case <-c.readDeadline.wait():
+		case <-c.closec:
+		}
+	}
+}
+
+func (c *memConn) Write(b []byte) (int, error) {
+	total := 0
+	for {
+		switch {
+		case isClosedChan(c.closec):
+			return total, io.ErrClosedPipe
+		case isClosedChan(c.writeDeadline.wait()):
+			return total, errTimeout
+		}
+
+		s := c.w
+		s.mu.Lock()
+		if s.rclosed {
+			s.mu.Unlock()
+			return total, io.ErrClosedPipe
+		}
+		if room := s.size - s.buf.Len(); room > 0 {
+			n := len(b)
+			if n > room {
+				n = room
+			}
+			_, _ = s.buf.Write(b[:n])
+			s.mu.Unlock()
+			notify(s.readable)
+			total += n
+			b = b[n:]
+			if len(b) == 0 {
+				return total, nil
+			}
+			continue
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-s.writable:
+		case <-c.writeDeadline.wait():
+		case <-c.closec:
+		}
+	}
+}
+
+// CloseWrite shuts down the writing side, the peer reads io.EOF after
+// the buffered data has been consumed.
+func (c *memConn) CloseWrite() error {
+	c.w.closeWrite()
+	return nil
+}
+
+func (c *memConn) Close() error {
+	err := io.ErrClosedPipe
+	c.closeOnce.Do(func() {
+		close(c.closec)
+		c.r.closeRead()
+		c.w.closeWrite()
+		err = nil
+	})
+	return err
+}
+
+func (c *memConn) LocalAddr() net.Addr  { return c.laddr }
+func (c *memConn) RemoteAddr() net.Addr { return c.raddr }
+
+func (c *memConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *memConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *memConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
+
+// NewMemPacketConnPair creates two in-memory net.PacketConns which can only
+// talk to each other, the packets are delivered in order and never lost,
+// the writes block if the peer's queue is full. It is useful to test the
+// handlers of NewPacketServerFromConn without binding ports.
+func NewMemPacketConnPair(addr1, addr2 string) (net.PacketConn, net.PacketConn) {
+	c1 := newMemPacketConn(MemAddr(addr1))
+	c2 := newMemPacketConn(MemAddr(addr2))
+	c1.peer, c2.peer = c2, c1
+	return c1, c2
+}
+
+type memPacket struct {
+	data []byte
+	from net.Addr
+}
+
+type memPacketConn struct {
+	laddr MemAddr
+	peer  *memPacketConn
+	queue chan memPacket
+
+	readDeadline  pipeDeadline
+	writeDeadline pipeDeadline
+	closec        chan struct{}
+	closeOnce     sync.Once
+}
+
+func newMemPacketConn(laddr MemAddr) *memPacketConn {
+	return &memPacketConn{
+		laddr:         laddr,
+		queue:         make(chan memPacket, defaultMemPacketQueueSize),
+		readDeadline:  makePipeDeadline(),
+		writeDeadline: makePipeDeadline(),
+		closec:        make(chan struct{}),
+	}
+}
+
+// ReadFrom reads a packet, the remaining data is discarded if p is too small.
+func (c *memPacketConn) ReadFrom(p []byte) (int, net.Addr, error) {
+	switch {
+	case isClosedChan(c.closec):
+		return 0, nil, io.ErrClosedPipe
+	case isClosedChan(c.readDeadline.wait()):
+		return 0, nil, errTimeout
+	}
+
+	select {
+	case pkt := <-c.queue:
+		return copy(p, pkt.data), pkt.from, nil
+	case <-c.readDeadline.wait():
+		return 0, nil, errTimeout
+	case <-c.closec:
+		return 0, nil, io.ErrClosedPipe
+	}
+}
+
+// WriteTo writes a packet to the peer, the packet is dropped silently if the peer is closed.
+func (c *memPacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	switch {
+	case isClosedChan(c.closec):
+		return 0, io.ErrClosedPipe
+	case isClosedChan(c.writeDeadline.wait()):
+		return 0, errTimeout
+	case addr == nil || addr.String() != c.peer.laddr.String():
+		return 0, ErrUnreachableAddress
+	}
+
+	pkt := memPacket{data: append([]byte(nil), b...), from: c.laddr}
+	select {
+	case c.peer.queue <- pkt:
+	case <-c.peer.closec:
+	case <-c.writeDeadline.wait():
+		return 0, errTimeout
+	case <-c.closec:
+		return 0, io.ErrClosedPipe
+	}
+	return len(b), nil
+}
+
+func (c *memPacketConn) Close() error {
+	err := io.ErrClosedPipe
+	c.closeOnce.Do(func() {
+		close(c.closec)
+		err = nil
+	})
+	return err
+}
+
+func (c *memPacketConn) LocalAddr() net.Addr { return c.laddr }
+
+func (c *memPacketConn) SetDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	c.writeDeadline.set(t)
+	return nil
+}
+
+func (c *memPacketConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+func (c *memPacketConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.set(t)
+	return nil
+}
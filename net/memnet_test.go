@@ -0,0 +1,109 @@
+package net
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemListener(t *testing.T) {
+	t.Parallel()
+
+	l := NewMemListener("echo", WithMemPipeBufferSize(16))
+	s := NewServerFromListener(l, func(_ context.Context, conn net.Conn) {
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	})
+	go s.Serve()
+	defer s.Close()
+	require.Equal(t, "echo", s.ListenAddr().String())
+	require.Equal(t, "mem", s.ListenAddr().Network())
+
+	for i := 0; i < 3; i++ {
+		conn, err := l.Dial()
+		require.Nil(t, err)
+		require.Equal(t, "echo", conn.RemoteAddr().String())
+		testEcho(t, conn, "larger than the buffer size")
+		conn.Close()
+	}
+
+	require.Nil(t, s.Close())
+	_, err := l.Dial()
+	require.Equal(t, ErrListenerClosed, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewMemListener("x").DialContext(ctx)
+	require.Equal(t, context.Canceled, err)
+}
+
+func TestMemPipe(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := MemPipe(WithMemPipeBufferSize(4))
+	n, err := c1.Write([]byte("abc"))
+	require.Nil(t, err)
+	require.Equal(t, 3, n)
+
+	// Blocked since the buffer is full.
+	require.Nil(t, c1.SetWriteDeadline(time.Now().Add(20*time.Millisecond)))
+	n, err = c1.Write([]byte("defg"))
+	require.Equal(t, 1, n)
+	nerr, ok := err.(net.Error)
+	require.True(t, ok)
+	require.True(t, nerr.Timeout())
+	require.Nil(t, c1.SetWriteDeadline(time.Time{}))
+
+	require.Nil(t, c2.SetReadDeadline(time.Now().Add(-time.Second)))
+	_, err = c2.Read(make([]byte, 1))
+	require.Equal(t, errTimeout, err)
+	require.Nil(t, c2.SetReadDeadline(time.Time{}))
+
+	go func() {
+		_, _ = c1.Write([]byte("hijk"))
+		_ = c1.Close()
+	}()
+	data, err := ioutil.ReadAll(c2)
+	require.Nil(t, err)
+	require.Equal(t, "abcdhijk", string(data))
+
+	_, err = c2.Write([]byte("x"))
+	require.Equal(t, io.ErrClosedPipe, err)
+	require.Nil(t, c2.Close())
+	_, err = c2.Read(make([]byte, 1))
+	require.Equal(t, io.ErrClosedPipe, err)
+}
+
+func TestMemPacketConnPair(t *testing.T) {
+	t.Parallel()
+
+	c1, c2 := NewMemPacketConnPair("client", "server")
+	s := NewPacketServerFromConn(c2, func(_ context.Context, conn net.PacketConn, addr net.Addr, data []byte) {
+		_, _ = conn.WriteTo(data, addr)
+	})
+	go s.Serve()
+	defer s.Close()
+
+	buf := make([]byte, 8)
+	for _, data := range []string{"hello", "world"} {
+		_, err := c1.WriteTo([]byte(data), s.ListenAddr())
+		require.Nil(t, err)
+		n, addr, err := c1.ReadFrom(buf)
+		require.Nil(t, err)
+		require.Equal(t, data, string(buf[:n]))
+		require.Equal(t, "server", addr.String())
+	}
+
+	_, err := c1.WriteTo([]byte("x"), MemAddr("unknown"))
+	require.Equal(t, ErrUnreachableAddress, err)
+	require.Nil(t, c1.SetReadDeadline(time.Now().Add(10*time.Millisecond)))
+	_, _, err = c1.ReadFrom(buf)
+	require.Equal(t, errTimeout, err)
+	require.Nil(t, c1.Close())
+	_, _, err = c1.ReadFrom(buf)
+	require.Equal(t, io.ErrClosedPipe, err)
+}
@@ -0,0 +1,323 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	ioext "github.com/damnever/libext-go/io"
+)
+
+var (
+	ErrListenerClosed    = errors.New("libext-go/net: listener closed")
+	ErrNoMatchedListener = errors.New("libext-go/net: no listener matched")
+)
+
+const (
+	defaultSniffTimeout = 3 * time.Second
+)
+
+// Matcher reports whether the connection belongs to a protocol by sniffing the
+// first bytes, the reader will be rewound for each Matcher. The Matcher should
+// read as few bytes as possible, reading beyond the data sent by the client
+// blocks until the sniff timeout.
+type Matcher func(r io.Reader) bool
+
+// MatchAny matches any connection, it is usually used as the last resort.
+func MatchAny() Matcher {
+	return func(io.Reader) bool { return true }
+}
+
+// MatchPrefix matches the connection starts with any of the prefixes.
+func MatchPrefix(prefixes ...[]byte) Matcher {
+	maxLen := 0
+	for _, prefix := range prefixes {
+		if len(prefix) > maxLen {
+			maxLen = len(prefix)
+		}
+	}
+	return func(r io.Reader) bool {
+		buf := make([]byte, 0, maxLen)
+		for len(buf) < maxLen {
+			candidate := false
+			for _, prefix := range prefixes {
+				if len(prefix) <= len(buf) {
+					if bytes.HasPrefix(buf, prefix) {
+						return true
+					}
+				} else if bytes.HasPrefix(prefix, buf) {
+					candidate = true
+				}
+			}
+			if !candidate {
+				return false
+			}
+			// Read byte by byte to avoid blocking, the data is buffered anyway.
+			var b [1]byte
+			if _, err := io.ReadFull(r, b[:]); err != nil {
+				return false
+			}
+			buf = append(buf, b[0])
+		}
+		for _, prefix := range prefixes {
+			if bytes.Equal(buf, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchHTTP1 matches the HTTP/1.x requests by the request method.
+func MatchHTTP1() Matcher {
+	methods := []string{"GET", "HEAD", "POST", "PUT", "DELETE", "CONNECT", "OPTIONS", "TRACE", "PATCH"}
+	prefixes := make([][]byte, 0, len(methods))
+	for _, method := range methods {
+		prefixes = append(prefixes, []byte(method+" "))
+	}
+	return MatchPrefix(prefixes...)
+}
+
+// MatchHTTP2 matches the HTTP/2 connection preface.
+func MatchHTTP2() Matcher {
+	return MatchPrefix([]byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"))
+}
+
+// MatchTLS matches the TLS ClientHello.
+func MatchTLS() Matcher {
+	return func(r io.Reader) bool {
+		// The record header: ContentType(handshake) + ProtocolVersion + Length,
+		// then the handshake type(client_hello).
+		var b [1]byte
+		for i := 0; i < 6; i++ {
+			if _, err := io.ReadFull(r, b[:]); err != nil {
+				return false
+			}
+			switch i {
+			case 0:
+				if b[0] != 0x16 {
+					return false
+				}
+			case 1:
+				if b[0] != 0x03 {
+					return false
+				}
+			case 2:
+				if b[0] > 0x04 {
+					return false
+				}
+			case 5:
+				return b[0] == 0x01
+			}
+		}
+		return false
+	}
+}
+
+type (
+	ListenerMuxOptions struct {
+		sniffTimeout time.Duration
+		onError      func(net.Conn, error)
+	}
+	WithListenerMuxOption func(opts *ListenerMuxOptions)
+)
+
+// WithSniffTimeout sets the timeout of sniffing, zero means no timeout.
+func WithSniffTimeout(timeout time.Duration) WithListenerMuxOption {
+	return func(opts *ListenerMuxOptions) {
+		opts.sniffTimeout = timeout
+	}
+}
+
+// WithSniffErrorHandler sets the handler which is called when a connection is
+// closed due to the failure of sniffing, the connection is already closed.
+func WithSniffErrorHandler(onError func(net.Conn, error)) WithListenerMuxOption {
+	return func(opts *ListenerMuxOptions) {
+		opts.onError = onError
+	}
+}
+
+var _defaultListenerMuxOptions = []WithListenerMuxOption{
+	WithSniffTimeout(defaultSniffTimeout),
+	WithSniffErrorHandler(func(net.Conn, error) {}),
+}
+
+func makeListenerMuxOptions(opts ...WithListenerMuxOption) ListenerMuxOptions {
+	var muxOpts ListenerMuxOptions
+	for _, opt := range _defaultListenerMuxOptions {
+		opt(&muxOpts)
+	}
+	for _, opt := range opts {
+		opt(&muxOpts)
+	}
+	return muxOpts
+}
+
+// ListenerMux serves multiple protocols on one listener, it sniffs the first bytes
+// of each accepted connection and dispatches it to the first sub-listener which
+// matches, the sniffed bytes are replayed on the dispatched connection.
+type ListenerMux struct {
+	*GenericServer
+
+	root net.Listener
+	opts ListenerMuxOptions
+
+	mu        sync.RWMutex
+	listeners []*muxListener
+	donec     chan struct{}
+}
+
+// NewListenerMux creates a new ListenerMux, the Serve must be called to start dispatching.
+func NewListenerMux(l net.Listener, opts ...WithListenerMuxOption) *ListenerMux {
+	m := &ListenerMux{
+		root:  l,
+		opts:  makeListenerMuxOptions(opts...),
+		donec: make(chan struct{}),
+	}
+	m.GenericServer = NewGenericServer(func(ctx context.Context) (func(), error) {
+		conn, err := l.Accept()
+		if err != nil {
+			return nil, err
+		}
+		return func() { m.dispatch(ctx, conn) }, nil
+	}, l.Close)
+	return m
+}
+
+// Match creates a sub-listener for connections which match any of the matchers,
+// the matchers are tried in the order of sub-listeners created.
+func (m *ListenerMux) Match(matchers ...Matcher) net.Listener {
+	l := &muxListener{
+		mux:      m,
+		matchers: matchers,
+		connc:    make(chan net.Conn),
+		closec:   make(chan struct{}),
+	}
+	m.mu.Lock()
+	m.listeners = append(m.listeners, l)
+	m.mu.Unlock()
+	return l
+}
+
+// Serve accepts and dispatches connections, the sub-listeners are closed after it returns.
+func (m *ListenerMux) Serve(opts ...WithServeOption) error {
+	err := m.GenericServer.Serve(opts...)
+	if !errors.Is(err, ErrAlreadyStarted) {
+		close(m.donec)
+	}
+	return err
+}
+
+func (m *ListenerMux) ListenAddr() net.Addr {
+	return m.root.Addr()
+}
+
+func (m *ListenerMux) dispatch(ctx context.Context, conn net.Conn) {
+	l, r, err := m.sniff(conn)
+	if err != nil {
+		_ = conn.Close()
+		m.opts.onError(conn, err)
+		return
+	}
+
+	select {
+	case l.connc <- &sniffedConn{Conn: conn, r: r}:
+	case <-l.closec:
+		_ = conn.Close()
+	case <-ctx.Done():
+		_ = conn.Close()
+	}
+}
+
+func (m *ListenerMux) sniff(conn net.Conn) (*muxListener, io.Reader, error) {
+	if m.opts.sniffTimeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(m.opts.sniffTimeout)); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	m.mu.RLock()
+	listeners := m.listeners
+	m.mu.RUnlock()
+
+	sr := &sniffReader{r: bufio.NewReader(conn)}
+	rr := ioext.NewRewindableReader(sr)
+	for _, l := range listeners {
+		for _, match := range l.matchers {
+			rr.Rewind()
+			if !match(rr) {
+				continue
+			}
+			if err := conn.SetReadDeadline(time.Time{}); err != nil {
+				return nil, nil, err
+			}
+			rr.Rewind()
+			return l, rr.Detach(), nil
+		}
+	}
+	if sr.err != nil { // E.g. the sniff timeout.
+		return nil, nil, sr.err
+	}
+	return nil, nil, ErrNoMatchedListener
+}
+
+// sniffReader records the last error of reading.
+type sniffReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *sniffReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil {
+		r.err = err
+	}
+	return n, err
+}
+
+type muxListener struct {
+	mux       *ListenerMux
+	matchers  []Matcher
+	connc     chan net.Conn
+	closec    chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *muxListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.connc:
+		return conn, nil
+	case <-l.closec:
+	case <-l.mux.donec:
+	}
+	return nil, ErrListenerClosed
+}
+
+// Close closes the sub-listener only, the ListenerMux is still working.
+func (l *muxListener) Close() error {
+	err := ErrListenerClosed
+	l.closeOnce.Do(func() {
+		close(l.closec)
+		err = nil
+	})
+	return err
+}
+
+func (l *muxListener) Addr() net.Addr {
+	return l.mux.root.Addr()
+}
+
+type sniffedConn struct {
+	net.Conn
+
+	r io.Reader
+}
+
+func (c *sniffedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,131 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenerMux(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	errc := make(chan error, 1)
+	m := NewListenerMux(l, WithSniffTimeout(50*time.Millisecond),
+		WithSniffErrorHandler(func(_ net.Conn, err error) { errc <- err }))
+
+	httpl := m.Match(MatchHTTP1())
+	magicl := m.Match(MatchPrefix([]byte("\x01MAGIC"), []byte("\x02MAGIC")))
+	anyl := m.Match(MatchPrefix([]byte("ANY")), MatchTLS())
+	go m.Serve()
+	defer m.Close()
+
+	hs := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("http:" + r.URL.Path))
+	})}
+	go hs.Serve(httpl)
+	defer hs.Close()
+	echo := func(prefix string) ConnHandleFunc {
+		return func(_ context.Context, conn net.Conn) {
+			defer conn.Close()
+			_, _ = conn.Write([]byte(prefix))
+			_, _ = io.Copy(conn, conn)
+		}
+	}
+	magics := NewServerFromListener(magicl, echo("magic:"))
+	go magics.Serve()
+	defer magics.Close()
+	anys := NewServerFromListener(anyl, echo("any:"))
+	go anys.Serve()
+	defer anys.Close()
+
+	addr := m.ListenAddr().String()
+	{ // HTTP/1
+		resp, err := http.Get("http://" + addr + "/foo")
+		require.Nil(t, err, "%v", err)
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.Nil(t, err)
+		require.Equal(t, "http:/foo", string(body))
+	}
+	for _, c := range []struct {
+		data     string
+		expected string
+	}{
+		{"\x01MAGIC hello", "magic:\x01MAGIC hello"},
+		{"\x02MAGIC", "magic:\x02MAGIC"},
+		{"ANY", "any:ANY"},
+		{"\x16\x03\x01\x00\x05\x01", "any:\x16\x03\x01\x00\x05\x01"},
+	} {
+		conn, err := net.Dial("tcp", addr)
+		require.Nil(t, err)
+		_, err = conn.Write([]byte(c.data))
+		require.Nil(t, err)
+		buf := make([]byte, len(c.expected))
+		_, err = io.ReadFull(conn, buf)
+		require.Nil(t, err)
+		require.Equal(t, c.expected, string(buf))
+		conn.Close()
+	}
+
+	for _, data := range []string{"\x03MAGIC", "", "\x01MAG"} {
+		conn, err := net.Dial("tcp", addr)
+		require.Nil(t, err)
+		_, err = conn.Write([]byte(data))
+		require.Nil(t, err)
+		_, err = conn.Read(make([]byte, 1))
+		require.Equal(t, io.EOF, err)
+		if err := <-errc; data == "\x03MAGIC" {
+			require.Equal(t, ErrNoMatchedListener, err)
+		} else { // Waiting for more data.
+			nerr, ok := err.(net.Error)
+			require.True(t, ok && nerr.Timeout(), "%v", err)
+		}
+		conn.Close()
+	}
+
+	require.Nil(t, magics.Close())
+	conn, err := net.Dial("tcp", addr)
+	require.Nil(t, err)
+	_, err = conn.Write([]byte("\x01MAGIC"))
+	require.Nil(t, err)
+	_, err = conn.Read(make([]byte, 1))
+	require.Equal(t, io.EOF, err)
+	conn.Close()
+
+	require.Nil(t, m.Close())
+	_, err = anyl.Accept()
+	require.Equal(t, ErrListenerClosed, err)
+}
+
+func TestMatchers(t *testing.T) {
+	for _, c := range []struct {
+		matcher Matcher
+		data    string
+		matched bool
+	}{
+		{MatchAny(), "", true},
+		{MatchPrefix([]byte("ab"), []byte("abcd")), "abc", true},
+		{MatchPrefix([]byte("abcd")), "abc", false},
+		{MatchPrefix([]byte("abcd")), "abce", false},
+		{MatchHTTP1(), "GET / HTTP/1.1\r\n", true},
+		{MatchHTTP1(), "OPTIONS * HTTP/1.1\r\n", true},
+		{MatchHTTP1(), "GETX / HTTP/1.1\r\n", false},
+		{MatchHTTP1(), "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", false},
+		{MatchHTTP2(), "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n", true},
+		{MatchHTTP2(), "PRI * HTTP/1.1\r\n", false},
+		{MatchTLS(), "\x16\x03\x01\x02\x00\x01\x00", true},
+		{MatchTLS(), "\x16\x03\x05\x02\x00\x01\x00", false},
+		{MatchTLS(), "\x16\x03\x03\x02\x00\x02\x00", false},
+		{MatchTLS(), "\x16\x03", false},
+	} {
+		require.Equal(t, c.matched, c.matcher(bufio.NewReader(bytes.NewReader([]byte(c.data)))), c.data)
+	}
+}
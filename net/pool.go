@@ -0,0 +1,336 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+var (
+	ErrPoolClosed     = errors.New("libext-go/net: connection pool closed")
+	ErrPoolConnClosed = errors.New("libext-go/net: pooled connection already closed")
+)
+
+const (
+	defaultPoolMaxIdle = 8
+)
+
+type (
+	// DialFunc creates a new connection, the context is used to cancel the dialing.
+	DialFunc func(ctx context.Context) (net.Conn, error)
+
+	// HealthCheckFunc checks an idle connection before handing it out, it is called
+	// with the time the connection was put back into the pool.
+	HealthCheckFunc func(conn net.Conn, idleSince time.Time) error
+
+	PoolOptions struct {
+		maxIdle      int
+		maxActive    int
+		idleTimeout  time.Duration
+		maxLifetime  time.Duration
+		readTimeout  time.Duration
+		writeTimeout time.Duration
+		healthCheck  HealthCheckFunc
+	}
+	WithPoolOption func(opts *PoolOptions)
+)
+
+// WithPoolMaxIdle sets the maximum number of idle connections, zero means no idle
+// connections are kept.
+func WithPoolMaxIdle(maxIdle int) WithPoolOption {
+	return func(opts *PoolOptions) {
+		opts.maxIdle = maxIdle
+	}
+}
+
+// WithPoolMaxActive sets the maximum number of connections allocated by the pool
+// at a given time, zero means no limit.
+func WithPoolMaxActive(maxActive int) WithPoolOption {
+	return func(opts *PoolOptions) {
+		opts.maxActive = maxActive
+	}
+}
+
+// WithPoolIdleTimeout closes connections which remain idle for the duration,
+// zero means connections are not closed due to idle time.
+func WithPoolIdleTimeout(idleTimeout time.Duration) WithPoolOption {
+	return func(opts *PoolOptions) {
+		opts.idleTimeout = idleTimeout
+	}
+}
+
+// WithPoolMaxLifetime closes connections older than the duration,
+// zero means connections are reused forever.
+func WithPoolMaxLifetime(maxLifetime time.Duration) WithPoolOption {
+	return func(opts *PoolOptions) {
+		opts.maxLifetime = maxLifetime
+	}
+}
+
+// WithPoolConnTimeouts sets the read and write deadline for each I/O operation on
+// connections returned by the pool, see NewTimedConn.
+func WithPoolConnTimeouts(readTimeout, writeTimeout time.Duration) WithPoolOption {
+	return func(opts *PoolOptions) {
+		opts.readTimeout = readTimeout
+		opts.writeTimeout = writeTimeout
+	}
+}
+
+// WithPoolHealthCheck sets the function to check idle connections on checkout,
+// connections failed the check will be closed.
+func WithPoolHealthCheck(healthCheck HealthCheckFunc) WithPoolOption {
+	return func(opts *PoolOptions) {
+		opts.healthCheck = healthCheck
+	}
+}
+
+var _defaultPoolOptions = []WithPoolOption{
+	WithPoolMaxIdle(defaultPoolMaxIdle),
+}
+
+func makePoolOptions(opts ...WithPoolOption) PoolOptions {
+	var poolOpts PoolOptions
+	for _, opt := range _defaultPoolOptions {
+		opt(&poolOpts)
+	}
+	for _, opt := range opts {
+		opt(&poolOpts)
+	}
+	return poolOpts
+}
+
+type idleConn struct {
+	conn      net.Conn
+	createdAt time.Time
+	idleSince time.Time
+}
+
+// ConnPool maintains a pool of connections, it is safe for concurrent use.
+type ConnPool struct {
+	dial DialFunc
+	opts PoolOptions
+
+	sem chan struct{} // nil if the maxActive is unlimited.
+
+	mu     sync.Mutex
+	idle   []idleConn // The most recently used is at the end.
+	active int
+	closed bool
+}
+
+func NewTCPConnPool(addr string, opts ...WithPoolOption) *ConnPool {
+	return NewConnPool(dialContextFunc("tcp", addr), opts...)
+}
+
+func NewUnixConnPool(sockpath string, opts ...WithPoolOption) *ConnPool {
+	return NewConnPool(dialContextFunc("unix", sockpath), opts...)
+}
+
+func dialContextFunc(network, addr string) DialFunc {
+	dialer := &net.Dialer{}
+	return func(ctx context.Context) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+}
+
+// NewConnPool creates a new ConnPool, the dial is used to create new connections.
+func NewConnPool(dial DialFunc, opts ...WithPoolOption) *ConnPool {
+	p := &ConnPool{
+		dial: dial,
+		opts: makePoolOptions(opts...),
+	}
+	if p.opts.maxActive > 0 {
+		p.sem = make(chan struct{}, p.opts.maxActive)
+	}
+	return p
+}
+
+// Get returns a connection from the pool or dials a new one, it waits until
+// a connection is available or the ctx is done if the pool is exhausted.
+// The returned connection must be closed to put it back into the pool.
+func (p *ConnPool) Get(ctx context.Context) (*PoolConn, error) {
+	if p.sem != nil {
+		select {
+		case p.sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	conn, err := p.get(ctx)
+	if err != nil {
+		p.release()
+		return nil, err
+	}
+	return conn, nil
+}
+
+func (p *ConnPool) get(ctx context.Context) (*PoolConn, error) {
+	now := time.Now()
+	for {
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			return nil, ErrPoolClosed
+		}
+		n := len(p.idle)
+		if n == 0 {
+			p.active++
+			p.mu.Unlock()
+			break
+		}
+		ic := p.idle[n-1]
+		p.idle[n-1] = idleConn{}
+		p.idle = p.idle[:n-1]
+		p.active++
+		p.mu.Unlock()
+
+		if p.isStale(ic, now) || (p.opts.healthCheck != nil && p.opts.healthCheck(ic.conn, ic.idleSince) != nil) {
+			_ = ic.conn.Close()
+			p.decActive()
+			continue
+		}
+		return p.wrapConn(ic.conn, ic.createdAt), nil
+	}
+
+	conn, err := p.dial(ctx)
+	if err != nil {
+		p.decActive()
+		return nil, err
+	}
+	return p.wrapConn(conn, now), nil
+}
+
+func (p *ConnPool) wrapConn(conn net.Conn, createdAt time.Time) *PoolConn {
+	return &PoolConn{
+		Conn:      conn,
+		r:         NewTimedConnReader(conn, p.opts.readTimeout),
+		w:         NewTimedConnWriter(conn, p.opts.writeTimeout),
+		pool:      p,
+		createdAt: createdAt,
+		broken:    atomic.NewBool(false),
+	}
+}
+
+func (p *ConnPool) isStale(ic idleConn, now time.Time) bool {
+	if p.opts.idleTimeout > 0 && ic.idleSince.Add(p.opts.idleTimeout).Before(now) {
+		return true
+	}
+	if p.opts.maxLifetime > 0 && ic.createdAt.Add(p.opts.maxLifetime).Before(now) {
+		return true
+	}
+	return false
+}
+
+func (p *ConnPool) put(conn net.Conn, createdAt time.Time, reusable bool) error {
+	defer p.release()
+
+	now := time.Now()
+	ic := idleConn{conn: conn, createdAt: createdAt, idleSince: now}
+	// Clear the deadlines set by the user, otherwise the next user inherits them.
+	if reusable && !p.isStale(ic, now) && conn.SetDeadline(time.Time{}) == nil {
+		p.mu.Lock()
+		if !p.closed && len(p.idle) < p.opts.maxIdle {
+			p.idle = append(p.idle, ic)
+			p.active--
+			p.mu.Unlock()
+			return nil
+		}
+		p.mu.Unlock()
+	}
+
+	p.decActive()
+	return conn.Close()
+}
+
+func (p *ConnPool) decActive() {
+	p.mu.Lock()
+	p.active--
+	p.mu.Unlock()
+}
+
+func (p *ConnPool) release() {
+	if p.sem != nil {
+		<-p.sem
+	}
+}
+
+// Stats returns the number of connections in use and the number of idle connections.
+func (p *ConnPool) Stats() (active, idle int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active, len(p.idle)
+}
+
+// Close closes the pool and all idle connections, the connections in use will
+// be closed once they are put back.
+func (p *ConnPool) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	p.closed = true
+	idle := p.idle
+	p.idle = nil
+	p.mu.Unlock()
+
+	var err error
+	for _, ic := range idle {
+		if cerr := ic.conn.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// PoolConn is a connection returned by the ConnPool, the Close puts it
+// back into the pool. The connection will be closed instead if any I/O
+// error occurred or it is marked as unusable by the Discard.
+type PoolConn struct {
+	net.Conn
+
+	r io.Reader
+	w io.Writer
+
+	pool      *ConnPool
+	createdAt time.Time
+	once      sync.Once
+	broken    *atomic.Bool
+}
+
+func (c *PoolConn) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err != nil {
+		c.broken.Store(true)
+	}
+	return n, err
+}
+
+func (c *PoolConn) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	if err != nil {
+		c.broken.Store(true)
+	}
+	return n, err
+}
+
+// Discard marks the connection as unusable, so that it will be closed rather
+// than put back into the pool.
+func (c *PoolConn) Discard() {
+	c.broken.Store(true)
+}
+
+// Close puts the connection back into the pool.
+func (c *PoolConn) Close() (err error) {
+	err = ErrPoolConnClosed
+	c.once.Do(func() {
+		err = c.pool.put(c.Conn, c.createdAt, !c.broken.Load())
+	})
+	return
+}
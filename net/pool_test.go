@@ -0,0 +1,191 @@
+package net
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnPool(t *testing.T) {
+	s := startEchoServer(t)
+	defer s.Close()
+	addr := s.ListenAddr().String()
+
+	p := NewTCPConnPool(addr, WithPoolMaxIdle(1), WithPoolMaxActive(2),
+		WithPoolConnTimeouts(time.Second, time.Second))
+	defer p.Close()
+
+	ctx := context.Background()
+	c1, err := p.Get(ctx)
+	require.Nil(t, err)
+	testEcho(t, c1, "c1")
+	c2, err := p.Get(ctx)
+	require.Nil(t, err)
+	testEcho(t, c2, "c2")
+	active, idle := p.Stats()
+	require.Equal(t, 2, active)
+	require.Equal(t, 0, idle)
+
+	{ // Exhausted.
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		_, err := p.Get(ctx)
+		cancel()
+		require.Equal(t, context.DeadlineExceeded, err)
+	}
+
+	raw := c1.Conn
+	require.Nil(t, c1.Close())
+	require.Equal(t, ErrPoolConnClosed, c1.Close())
+	require.Nil(t, c2.Close()) // Exceeds the max idle.
+	active, idle = p.Stats()
+	require.Equal(t, 0, active)
+	require.Equal(t, 1, idle)
+
+	c3, err := p.Get(ctx)
+	require.Nil(t, err)
+	require.Equal(t, raw, c3.Conn)
+	c3.Discard()
+	require.Nil(t, c3.Close())
+	active, idle = p.Stats()
+	require.Equal(t, 0, active)
+	require.Equal(t, 0, idle)
+
+	require.Nil(t, p.Close())
+	_, err = p.Get(ctx)
+	require.Equal(t, ErrPoolClosed, err)
+}
+
+func TestConnPool_WaitForRelease(t *testing.T) {
+	s := startEchoServer(t)
+	defer s.Close()
+	addr := s.ListenAddr().String()
+
+	p := NewTCPConnPool(addr, WithPoolMaxActive(1))
+	defer p.Close()
+
+	c1, err := p.Get(context.Background())
+	require.Nil(t, err)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		c1.Close()
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c2, err := p.Get(ctx)
+	require.Nil(t, err)
+	require.Equal(t, c1.Conn, c2.Conn)
+	require.Nil(t, c2.Close())
+}
+
+func TestConnPool_StaleAndHealthCheck(t *testing.T) {
+	s := startEchoServer(t)
+	defer s.Close()
+	addr := s.ListenAddr().String()
+	ctx := context.Background()
+
+	{ // Idle timeout.
+		p := NewTCPConnPool(addr, WithPoolIdleTimeout(10*time.Millisecond))
+		c1, err := p.Get(ctx)
+		require.Nil(t, err)
+		require.Nil(t, c1.Close())
+		time.Sleep(20 * time.Millisecond)
+		c2, err := p.Get(ctx)
+		require.Nil(t, err)
+		require.NotEqual(t, c1.Conn, c2.Conn)
+		require.Nil(t, c2.Close())
+		require.Nil(t, p.Close())
+	}
+	{ // Max lifetime.
+		p := NewTCPConnPool(addr, WithPoolMaxLifetime(10*time.Millisecond))
+		c1, err := p.Get(ctx)
+		require.Nil(t, err)
+		time.Sleep(20 * time.Millisecond)
+		require.Nil(t, c1.Close())
+		_, idle := p.Stats()
+		require.Equal(t, 0, idle)
+		require.Nil(t, p.Close())
+	}
+	{ // Health check.
+		checked := 0
+		p := NewTCPConnPool(addr, WithPoolHealthCheck(func(net.Conn, time.Time) error {
+			checked++
+			return errors.New("unhealthy")
+		}))
+		c1, err := p.Get(ctx)
+		require.Nil(t, err)
+		require.Nil(t, c1.Close())
+		c2, err := p.Get(ctx)
+		require.Nil(t, err)
+		require.NotEqual(t, c1.Conn, c2.Conn)
+		require.Equal(t, 1, checked)
+		require.Nil(t, c2.Close())
+		require.Nil(t, p.Close())
+	}
+}
+
+func TestConnPool_BrokenConn(t *testing.T) {
+	s := startEchoServer(t)
+	defer s.Close()
+	addr := s.ListenAddr().String()
+
+	p := NewTCPConnPool(addr, WithPoolConnTimeouts(10*time.Millisecond, 0))
+	defer p.Close()
+
+	c, err := p.Get(context.Background())
+	require.Nil(t, err)
+	_, err = c.Read(make([]byte, 1)) // Nothing to read.
+	require.NotNil(t, err)
+	require.Nil(t, c.Close())
+	_, idle := p.Stats()
+	require.Equal(t, 0, idle)
+}
+
+func TestConnPool_ClearDeadline(t *testing.T) {
+	s := startEchoServer(t)
+	defer s.Close()
+	addr := s.ListenAddr().String()
+
+	p := NewTCPConnPool(addr)
+	defer p.Close()
+
+	c, err := p.Get(context.Background())
+	require.Nil(t, err)
+	testEcho(t, c, "c")
+	require.Nil(t, c.SetDeadline(time.Unix(1, 0)))
+	raw := c.Conn
+	require.Nil(t, c.Close())
+
+	c, err = p.Get(context.Background())
+	require.Nil(t, err)
+	require.Equal(t, raw, c.Conn)
+	testEcho(t, c, "again")
+	require.Nil(t, c.Close())
+}
+
+func startEchoServer(t *testing.T) *Server {
+	t.Helper()
+
+	s, err := NewTCPServer("127.0.0.1:0", func(_ context.Context, conn net.Conn) {
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	})
+	require.Nil(t, err)
+	go s.Serve()
+	return s
+}
+
+func testEcho(t *testing.T, conn net.Conn, data string) {
+	t.Helper()
+
+	_, err := conn.Write([]byte(data))
+	require.Nil(t, err)
+	buf := make([]byte, len(data))
+	_, err = io.ReadFull(conn, buf)
+	require.Nil(t, err)
+	require.Equal(t, data, string(buf))
+}
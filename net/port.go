@@ -0,0 +1,181 @@
+package net
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+)
+
+var (
+	ErrNoFreePort          = errors.New("libext-go/net: no free port")
+	ErrPortNotReserved     = errors.New("libext-go/net: port not reserved for the protocol or already taken")
+	ErrInvalidPortCount    = errors.New("libext-go/net: invalid port count")
+	ErrInvalidPortProtocol = errors.New("libext-go/net: invalid port protocol")
+)
+
+const (
+	maxPortReserveAttempts = 32
+	maxPort                = 65535
+)
+
+// PortProtocol is the protocol of the reserved port, it can be combined.
+type PortProtocol int
+
+const (
+	PortTCP PortProtocol = 1 << iota
+	PortUDP
+
+	PortTCPAndUDP = PortTCP | PortUDP
+)
+
+// PortReservation holds the bound listener and/or packet conn of a free port,
+// they can be taken to serve directly, so there is no close-then-rebind race.
+type PortReservation struct {
+	host string
+	port int
+
+	mu       sync.Mutex
+	listener net.Listener
+	conn     net.PacketConn
+}
+
+// ReservePort reserves a free port on the host, the empty host means all
+// addresses. If the protocol is PortTCPAndUDP, both are bound on the same number.
+func ReservePort(host string, proto PortProtocol) (*PortReservation, error) {
+	if proto&PortTCPAndUDP == 0 {
+		return nil, ErrInvalidPortProtocol
+	}
+	for i := 0; i < maxPortReserveAttempts; i++ {
+		r, err := bindPort(host, 0, proto)
+		if err == nil {
+			return r, nil
+		}
+		if proto != PortTCPAndUDP {
+			return nil, err
+		}
+		// The UDP port is in use, try another one.
+	}
+	return nil, ErrNoFreePort
+}
+
+// ReserveContiguousPorts reserves n free ports with contiguous numbers on the host.
+func ReserveContiguousPorts(host string, proto PortProtocol, n int) ([]*PortReservation, error) {
+	if n <= 0 {
+		return nil, ErrInvalidPortCount
+	}
+
+	for i := 0; i < maxPortReserveAttempts; i++ {
+		first, err := ReservePort(host, proto)
+		if err != nil {
+			return nil, err
+		}
+		reservations := []*PortReservation{first}
+		for port := first.port + 1; port < first.port+n && port <= maxPort; port++ {
+			r, err := bindPort(host, port, proto)
+			if err != nil {
+				break
+			}
+			reservations = append(reservations, r)
+		}
+		if len(reservations) == n {
+			return reservations, nil
+		}
+		for _, r := range reservations {
+			_ = r.Close()
+		}
+	}
+	return nil, ErrNoFreePort
+}
+
+func bindPort(host string, port int, proto PortProtocol) (*PortReservation, error) {
+	r := &PortReservation{host: host, port: port}
+	if proto&PortTCP != 0 {
+		l, err := net.Listen("tcp", r.Addr())
+		if err != nil {
+			return nil, err
+		}
+		r.listener = l
+		r.port = l.Addr().(*net.TCPAddr).Port
+	}
+	if proto&PortUDP != 0 {
+		conn, err := net.ListenPacket("udp", r.Addr())
+		if err != nil {
+			_ = r.Close()
+			return nil, err
+		}
+		r.conn = conn
+		r.port = conn.LocalAddr().(*net.UDPAddr).Port
+	}
+	return r, nil
+}
+
+// Port returns the reserved port number.
+func (r *PortReservation) Port() int {
+	return r.port
+}
+
+// Addr returns the address in the form of "host:port".
+func (r *PortReservation) Addr() string {
+	return net.JoinHostPort(r.host, strconv.Itoa(r.port))
+}
+
+// Listener takes the bound TCP listener, the caller owns it afterwards.
+func (r *PortReservation) Listener() (net.Listener, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.listener == nil {
+		return nil, ErrPortNotReserved
+	}
+	l := r.listener
+	r.listener = nil
+	return l, nil
+}
+
+// PacketConn takes the bound UDP conn, the caller owns it afterwards.
+func (r *PortReservation) PacketConn() (net.PacketConn, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.conn == nil {
+		return nil, ErrPortNotReserved
+	}
+	conn := r.conn
+	r.conn = nil
+	return conn, nil
+}
+
+// NewServer takes the bound TCP listener to create a Server.
+func (r *PortReservation) NewServer(handleConn ConnHandleFunc) (*Server, error) {
+	l, err := r.Listener()
+	if err != nil {
+		return nil, err
+	}
+	return NewServerFromListener(l, handleConn), nil
+}
+
+// NewPacketServer takes the bound UDP conn to create a PacketServer.
+func (r *PortReservation) NewPacketServer(handleConn PacketHandleFunc) (*PacketServer, error) {
+	conn, err := r.PacketConn()
+	if err != nil {
+		return nil, err
+	}
+	return NewPacketServerFromConn(conn, handleConn), nil
+}
+
+// Close releases the port, the taken listener and conn are not affected.
+func (r *PortReservation) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	if r.listener != nil {
+		err = r.listener.Close()
+		r.listener = nil
+	}
+	if r.conn != nil {
+		if cerr := r.conn.Close(); err == nil {
+			err = cerr
+		}
+		r.conn = nil
+	}
+	return err
+}
@@ -0,0 +1,74 @@
+package net
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservePort(t *testing.T) {
+	r, err := ReservePort("127.0.0.1", PortTCP)
+	require.Nil(t, err)
+	require.True(t, r.Port() > 0)
+	_, err = r.PacketConn()
+	require.Equal(t, ErrPortNotReserved, err)
+	s, err := r.NewServer(func(_ context.Context, conn net.Conn) {
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	})
+	require.Nil(t, err)
+	go s.Serve()
+	defer s.Close()
+	require.Equal(t, r.Addr(), s.ListenAddr().String())
+	_, err = r.Listener()
+	require.Equal(t, ErrPortNotReserved, err)
+	require.Nil(t, r.Close()) // The taken listener is not affected.
+
+	conn, err := net.Dial("tcp", r.Addr())
+	require.Nil(t, err)
+	testEcho(t, conn, "reserved")
+	conn.Close()
+
+	_, err = ReservePort("127.0.0.1", 0)
+	require.Equal(t, ErrInvalidPortProtocol, err)
+}
+
+func TestReservePortTCPAndUDP(t *testing.T) {
+	r, err := ReservePort("127.0.0.1", PortTCPAndUDP)
+	require.Nil(t, err)
+	l, err := r.Listener()
+	require.Nil(t, err)
+	defer l.Close()
+	pc, err := r.PacketConn()
+	require.Nil(t, err)
+	defer pc.Close()
+	require.Equal(t, r.Port(), l.Addr().(*net.TCPAddr).Port)
+	require.Equal(t, r.Port(), pc.LocalAddr().(*net.UDPAddr).Port)
+
+	r, err = ReservePort("127.0.0.1", PortUDP)
+	require.Nil(t, err)
+	_, err = net.ListenPacket("udp", r.Addr())
+	require.NotNil(t, err)
+	require.Nil(t, r.Close())
+	pc, err = net.ListenPacket("udp", r.Addr())
+	require.Nil(t, err)
+	pc.Close()
+}
+
+func TestReserveContiguousPorts(t *testing.T) {
+	rs, err := ReserveContiguousPorts("127.0.0.1", PortTCPAndUDP, 4)
+	require.Nil(t, err)
+	require.Len(t, rs, 4)
+	for i, r := range rs {
+		require.Equal(t, rs[0].Port()+i, r.Port())
+		_, err := net.Listen("tcp", r.Addr())
+		require.NotNil(t, err)
+		require.Nil(t, r.Close())
+	}
+
+	_, err = ReserveContiguousPorts("127.0.0.1", PortTCP, 0)
+	require.Equal(t, ErrInvalidPortCount, err)
+}
@@ -0,0 +1,458 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	binaryext "github.com/damnever/libext-go/encoding/binary"
+)
+
+// Ref: https://www.haproxy.org/download/2.3/doc/proxy-protocol.txt
+
+var (
+	ErrInvalidProxyHeader  = errors.New("libext-go/net: invalid PROXY protocol header")
+	ErrProxyHeaderRequired = errors.New("libext-go/net: PROXY protocol header required")
+)
+
+const (
+	defaultProxyHeaderTimeout = 5 * time.Second
+
+	proxyV1MaxLineLen = 107
+	proxyV2HeaderLen  = 16
+)
+
+var (
+	proxyV1Signature = []byte("PROXY ")                                                               //nolint:gochecknoglobals
+	proxyV2Signature = []byte{0x0D, 0x0A, 0x0D, 0x0A, 0x00, 0x0D, 0x0A, 0x51, 0x55, 0x49, 0x54, 0x0A} //nolint:gochecknoglobals
+)
+
+// ProxyCommand is the command of the PROXY protocol header.
+type ProxyCommand uint8
+
+const (
+	// ProxyCommandLocal means the connection was established on purpose by the proxy
+	// without being relayed, the real connection endpoints should be used.
+	ProxyCommandLocal ProxyCommand = 0x0
+	// ProxyCommandProxy means the connection was established on behalf of another node.
+	ProxyCommandProxy ProxyCommand = 0x1
+)
+
+// The registered TLV types of the PROXY protocol v2.
+const (
+	ProxyTLVTypeALPN      uint8 = 0x01
+	ProxyTLVTypeAuthority uint8 = 0x02
+	ProxyTLVTypeCRC32C    uint8 = 0x03
+	ProxyTLVTypeNoop      uint8 = 0x04
+	ProxyTLVTypeUniqueID  uint8 = 0x05
+	ProxyTLVTypeSSL       uint8 = 0x20
+	ProxyTLVTypeNetNS     uint8 = 0x30
+)
+
+// ProxyTLV is a Type-Length-Value vector of the PROXY protocol v2 header.
+type ProxyTLV struct {
+	Type  uint8
+	Value []byte
+}
+
+// ProxyHeader is the parsed PROXY protocol header, the SourceAddr and DestinationAddr
+// are nil if the command is local or the protocol is unknown.
+type ProxyHeader struct {
+	Version         int
+	Command         ProxyCommand
+	SourceAddr      net.Addr
+	DestinationAddr net.Addr
+	TLVs            []ProxyTLV
+}
+
+type (
+	ProxyProtoOptions struct {
+		headerTimeout time.Duration
+		trusted       *IPSet
+		required      bool
+	}
+	WithProxyProtoOption func(opts *ProxyProtoOptions)
+)
+
+// WithProxyHeaderTimeout sets the timeout of reading the header, zero means no timeout.
+func WithProxyHeaderTimeout(timeout time.Duration) WithProxyProtoOption {
+	return func(opts *ProxyProtoOptions) {
+		opts.headerTimeout = timeout
+	}
+}
+
+// WithTrustedUpstreams only parses headers from the upstreams within the set, connections
+// from other upstreams are returned as it is.
+//
+// WARNING: all upstreams are trusted by default, so any client can spoof its
+// address by sending a header, always set it if the listener is reachable by
+// untrusted clients.
+func WithTrustedUpstreams(trusted *IPSet) WithProxyProtoOption {
+	return func(opts *ProxyProtoOptions) {
+		opts.trusted = trusted
+	}
+}
+
+// WithProxyHeaderRequired rejects the connections from trusted upstreams without header,
+// the header is optional by default.
+func WithProxyHeaderRequired() WithProxyProtoOption {
+	return func(opts *ProxyProtoOptions) {
+		opts.required = true
+	}
+}
+
+var _defaultProxyProtoOptions = []WithProxyProtoOption{
+	WithProxyHeaderTimeout(defaultProxyHeaderTimeout),
+}
+
+func makeProxyProtoOptions(opts ...WithProxyProtoOption) ProxyProtoOptions {
+	var proxyOpts ProxyProtoOptions
+	for _, opt := range _defaultProxyProtoOptions {
+		opt(&proxyOpts)
+	}
+	for _, opt := range opts {
+		opt(&proxyOpts)
+	}
+	return proxyOpts
+}
+
+type proxyProtoListener struct {
+	net.Listener
+
+	opts ProxyProtoOptions
+}
+
+// NewProxyProtoListener wraps the listener to parse the PROXY protocol v1 and v2 headers,
+// the header is parsed on the first call of Read, Header, RemoteAddr or LocalAddr of the
+// accepted connection, so the Accept will not be blocked by the slow clients.
+//
+// NOTE that those calls block until the header is parsed or the header timeout
+// expires, so do not call them in the accept loop(e.g. for logging or access
+// control), call them in the goroutine handling the connection instead.
+//
+// WARNING: all upstreams are trusted by default, see WithTrustedUpstreams.
+func NewProxyProtoListener(l net.Listener, opts ...WithProxyProtoOption) net.Listener {
+	return proxyProtoListener{
+		Listener: l,
+		opts:     makeProxyProtoOptions(opts...),
+	}
+}
+
+func (l proxyProtoListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if l.opts.trusted != nil && !l.opts.trusted.Contains(addrIP(conn.RemoteAddr())) {
+		return conn, nil
+	}
+	return NewProxyProtoConn(conn, l.opts), nil
+}
+
+// ProxyProtoConn is a net.Conn which presents the addresses in the PROXY protocol header.
+type ProxyProtoConn struct {
+	net.Conn
+
+	opts   ProxyProtoOptions
+	once   sync.Once
+	r      *bufio.Reader
+	header *ProxyHeader
+	err    error
+
+	deadlineMu   sync.Mutex
+	readDeadline time.Time // The read deadline set by the caller.
+}
+
+// NewProxyProtoConn creates a new ProxyProtoConn, the trusted upstreams option is ignored.
+func NewProxyProtoConn(conn net.Conn, opts ProxyProtoOptions) *ProxyProtoConn {
+	return &ProxyProtoConn{
+		Conn: conn,
+		opts: opts,
+		r:    bufio.NewReader(conn),
+	}
+}
+
+// Header returns the parsed header, the header is nil if there is no header.
+func (c *ProxyProtoConn) Header() (*ProxyHeader, error) {
+	c.once.Do(c.parseHeader)
+	return c.header, c.err
+}
+
+func (c *ProxyProtoConn) Read(p []byte) (int, error) {
+	if _, err := c.Header(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// SetDeadline sets the read and write deadlines, the read deadline is kept while
+// the header is being parsed and restored afterwards.
+func (c *ProxyProtoConn) SetDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline, it is kept while the header is being
+// parsed and restored afterwards.
+func (c *ProxyProtoConn) SetReadDeadline(t time.Time) error {
+	c.deadlineMu.Lock()
+	defer c.deadlineMu.Unlock()
+	c.readDeadline = t
+	return c.Conn.SetReadDeadline(t)
+}
+
+// RemoteAddr returns the source address in the header if present,
+// otherwise the remote address of the underlying connection.
+//
+// NOTE that it blocks until the header is parsed, see NewProxyProtoListener.
+func (c *ProxyProtoConn) RemoteAddr() net.Addr {
+	if header, _ := c.Header(); header != nil && header.SourceAddr != nil {
+		return header.SourceAddr
+	}
+	return c.Conn.RemoteAddr()
+}
+
+// LocalAddr returns the destination address in the header if present,
+// otherwise the local address of the underlying connection.
+//
+// NOTE that it blocks until the header is parsed, see NewProxyProtoListener.
+func (c *ProxyProtoConn) LocalAddr() net.Addr {
+	if header, _ := c.Header(); header != nil && header.DestinationAddr != nil {
+		return header.DestinationAddr
+	}
+	return c.Conn.LocalAddr()
+}
+
+func (c *ProxyProtoConn) parseHeader() {
+	if c.opts.headerTimeout > 0 {
+		c.deadlineMu.Lock()
+		deadline := time.Now().Add(c.opts.headerTimeout)
+		if !c.readDeadline.IsZero() && c.readDeadline.Before(deadline) {
+			deadline = c.readDeadline
+		}
+		c.err = c.Conn.SetReadDeadline(deadline)
+		c.deadlineMu.Unlock()
+		if c.err != nil {
+			return
+		}
+		defer func() {
+			c.deadlineMu.Lock()
+			defer c.deadlineMu.Unlock()
+			// Restore the deadline set by the caller.
+			if err := c.Conn.SetReadDeadline(c.readDeadline); err != nil && c.err == nil {
+				c.err = err
+			}
+		}()
+	}
+
+	b, err := c.r.Peek(1)
+	if err != nil {
+		var nerr net.Error
+		if errors.As(err, &nerr) && nerr.Timeout() && !c.opts.required {
+			c.r.Reset(c.Conn) // Nothing received, it may be a server-first protocol.
+			return
+		}
+		c.err = err
+		return
+	}
+	switch b[0] {
+	case proxyV1Signature[0]:
+		if c.hasPrefix(proxyV1Signature) {
+			c.header, c.err = parseProxyHeaderV1(c.r)
+			return
+		}
+	case proxyV2Signature[0]:
+		if c.hasPrefix(proxyV2Signature) {
+			c.header, c.err = parseProxyHeaderV2(c.r)
+			return
+		}
+	}
+	if c.err == nil && c.opts.required {
+		c.err = ErrProxyHeaderRequired
+	}
+}
+
+// hasPrefix reports whether the data starts with the prefix, a short read, e.g.
+// timeout, means no header if the header is optional, the bytes peeked are kept
+// in the reader.
+func (c *ProxyProtoConn) hasPrefix(prefix []byte) bool {
+	b, err := c.r.Peek(len(prefix))
+	if err != nil && (!c.opts.required || !bytes.HasPrefix(prefix, b)) {
+		return false
+	}
+	if err != nil {
+		c.err = err
+		return false
+	}
+	return bytes.Equal(prefix, b)
+}
+
+func parseProxyHeaderV1(r *bufio.Reader) (*ProxyHeader, error) {
+	line, err := r.ReadSlice('\n')
+	if err != nil {
+		if errors.Is(err, bufio.ErrBufferFull) {
+			return nil, ErrInvalidProxyHeader
+		}
+		return nil, err
+	}
+	if len(line) > proxyV1MaxLineLen || !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	parts := strings.Split(string(line[:len(line)-2]), " ")
+	header := &ProxyHeader{Version: 1, Command: ProxyCommandProxy}
+	if len(parts) >= 2 && parts[1] == "UNKNOWN" {
+		header.Command = ProxyCommandLocal
+		return header, nil
+	}
+	if len(parts) != 6 || (parts[1] != "TCP4" && parts[1] != "TCP6") {
+		return nil, ErrInvalidProxyHeader
+	}
+	srcIP, dstIP := net.ParseIP(parts[2]), net.ParseIP(parts[3])
+	srcPort, srcErr := parseProxyPort(parts[4])
+	dstPort, dstErr := parseProxyPort(parts[5])
+	if srcIP == nil || dstIP == nil || srcErr != nil || dstErr != nil {
+		return nil, ErrInvalidProxyHeader
+	}
+	isv4 := parts[1] == "TCP4"
+	if (srcIP.To4() != nil) != isv4 || (dstIP.To4() != nil) != isv4 {
+		return nil, ErrInvalidProxyHeader
+	}
+	header.SourceAddr = &net.TCPAddr{IP: srcIP, Port: srcPort}
+	header.DestinationAddr = &net.TCPAddr{IP: dstIP, Port: dstPort}
+	return header, nil
+}
+
+func parseProxyPort(s string) (int, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || (len(s) > 1 && s[0] == '0') {
+		return 0, ErrInvalidProxyHeader
+	}
+	return int(port), nil
+}
+
+func parseProxyHeaderV2(r *bufio.Reader) (*ProxyHeader, error) {
+	var hdr [proxyV2HeaderLen]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	verCmd, famProto := hdr[12], hdr[13]
+	if verCmd>>4 != 2 {
+		return nil, ErrInvalidProxyHeader
+	}
+	header := &ProxyHeader{Version: 2, Command: ProxyCommand(verCmd & 0x0F)}
+	if header.Command != ProxyCommandLocal && header.Command != ProxyCommandProxy {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	payload := make([]byte, int(hdr[14])<<8|int(hdr[15]))
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	br := binaryext.NewBigEndianReader(bytes.NewReader(payload))
+	srcAddr, dstAddr, addrLen, err := readProxyV2Addrs(br, famProto, len(payload))
+	if err != nil {
+		return nil, err
+	}
+	if header.Command == ProxyCommandProxy {
+		header.SourceAddr, header.DestinationAddr = srcAddr, dstAddr
+	}
+	if header.TLVs, err = readProxyV2TLVs(br, len(payload)-addrLen); err != nil {
+		return nil, err
+	}
+	return header, nil
+}
+
+func readProxyV2Addrs(br *binaryext.Reader, famProto byte, size int) (src, dst net.Addr, n int, err error) {
+	fam, proto := famProto>>4, famProto&0x0F
+	if proto > 0x2 {
+		return nil, nil, 0, ErrInvalidProxyHeader
+	}
+
+	switch fam {
+	case 0x0: // AF_UNSPEC
+		return nil, nil, 0, nil
+	case 0x1, 0x2: // AF_INET, AF_INET6
+		iplen := net.IPv4len
+		if fam == 0x2 {
+			iplen = net.IPv6len
+		}
+		n = 2*iplen + 4
+		if size < n {
+			return nil, nil, 0, ErrInvalidProxyHeader
+		}
+		srcIP, dstIP := make(net.IP, iplen), make(net.IP, iplen)
+		var srcPort, dstPort uint16
+		if _, err = io.ReadFull(br, srcIP); err == nil {
+			if _, err = io.ReadFull(br, dstIP); err == nil {
+				if err = br.ReadUint16(&srcPort); err == nil {
+					err = br.ReadUint16(&dstPort)
+				}
+			}
+		}
+		if err != nil {
+			return nil, nil, 0, ErrInvalidProxyHeader
+		}
+		if proto == 0x2 { // DGRAM
+			return &net.UDPAddr{IP: srcIP, Port: int(srcPort)}, &net.UDPAddr{IP: dstIP, Port: int(dstPort)}, n, nil
+		}
+		return &net.TCPAddr{IP: srcIP, Port: int(srcPort)}, &net.TCPAddr{IP: dstIP, Port: int(dstPort)}, n, nil
+	case 0x3: // AF_UNIX
+		var srcPath, dstPath [108]byte
+		if size < len(srcPath)+len(dstPath) {
+			return nil, nil, 0, ErrInvalidProxyHeader
+		}
+		if _, err = io.ReadFull(br, srcPath[:]); err == nil {
+			_, err = io.ReadFull(br, dstPath[:])
+		}
+		if err != nil {
+			return nil, nil, 0, ErrInvalidProxyHeader
+		}
+		network := "unix"
+		if proto == 0x2 {
+			network = "unixgram"
+		}
+		return &net.UnixAddr{Name: cstring(srcPath[:]), Net: network},
+			&net.UnixAddr{Name: cstring(dstPath[:]), Net: network}, len(srcPath) + len(dstPath), nil
+	}
+	return nil, nil, 0, ErrInvalidProxyHeader
+}
+
+func readProxyV2TLVs(br *binaryext.Reader, remaining int) ([]ProxyTLV, error) {
+	var tlvs []ProxyTLV
+	for remaining > 0 {
+		if remaining < 3 {
+			return nil, ErrInvalidProxyHeader
+		}
+		var typ uint8
+		var length uint16
+		if err := br.ReadUint8(&typ); err != nil {
+			return nil, ErrInvalidProxyHeader
+		}
+		if err := br.ReadUint16(&length); err != nil {
+			return nil, ErrInvalidProxyHeader
+		}
+		value := make([]byte, length)
+		if _, err := io.ReadFull(br, value); err != nil {
+			return nil, ErrInvalidProxyHeader
+		}
+		tlvs = append(tlvs, ProxyTLV{Type: typ, Value: value})
+		remaining -= 3 + int(length)
+	}
+	return tlvs, nil
+}
+
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
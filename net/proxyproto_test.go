@@ -0,0 +1,254 @@
+package net
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProxyProtoListener_V1(t *testing.T) {
+	addr, remoteAddrs, closeFn := startProxyProtoServer(t)
+	defer closeFn()
+
+	for _, c := range []struct {
+		header   string
+		expected string
+	}{
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n", "192.168.0.1:56324"},
+		{"PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324"},
+		{"PROXY UNKNOWN\r\n", ""},
+		{"PROXY UNKNOWN ffff:f...f:ffff ffff:f...f:ffff 65535 65535\r\n", ""},
+		{"", ""},
+	} {
+		conn, err := net.Dial("tcp", addr)
+		require.Nil(t, err)
+		_, err = conn.Write([]byte(c.header + "hello\n"))
+		require.Nil(t, err)
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		require.Nil(t, err)
+		require.Equal(t, "hello\n", line)
+		remoteAddr := <-remoteAddrs
+		if c.expected == "" {
+			c.expected = conn.LocalAddr().String()
+		}
+		require.Equal(t, c.expected, remoteAddr, c.header)
+		conn.Close()
+	}
+
+	for _, header := range []string{
+		"PROXY TCP4 192.168.0.1 2001:db8::2 56324 443\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 056324 443\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 65536 443\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 56324\r\n",
+		"PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\n",
+	} {
+		conn, err := net.Dial("tcp", addr)
+		require.Nil(t, err)
+		_, err = conn.Write([]byte(header + "hello\n"))
+		require.Nil(t, err)
+		_, err = bufio.NewReader(conn).ReadString('\n')
+		require.Equal(t, io.EOF, err, header)
+		conn.Close()
+	}
+}
+
+func TestProxyProtoListener_V2(t *testing.T) {
+	addr, remoteAddrs, closeFn := startProxyProtoServer(t)
+	defer closeFn()
+
+	for _, c := range []struct {
+		header   []byte
+		expected string
+	}{
+		{
+			makeProxyHeaderV2(0x21, 0x11, append(append([]byte{192, 168, 0, 1, 192, 168, 0, 11}, 0xDC, 0x04, 0x01, 0xBB),
+				ProxyTLVTypeAuthority, 0x00, 0x03, 'f', 'o', 'o')),
+			"192.168.0.1:56324",
+		},
+		{
+			makeProxyHeaderV2(0x21, 0x21, append(append(net.ParseIP("2001:db8::1"), net.ParseIP("2001:db8::2")...),
+				0xDC, 0x04, 0x01, 0xBB)),
+			"[2001:db8::1]:56324",
+		},
+		{ // LOCAL
+			makeProxyHeaderV2(0x20, 0x11, []byte{192, 168, 0, 1, 192, 168, 0, 11, 0xDC, 0x04, 0x01, 0xBB}),
+			"",
+		},
+		{ // UNSPEC
+			makeProxyHeaderV2(0x21, 0x00, nil),
+			"",
+		},
+	} {
+		conn, err := net.Dial("tcp", addr)
+		require.Nil(t, err)
+		_, err = conn.Write(append(c.header, "hello\n"...))
+		require.Nil(t, err)
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		require.Nil(t, err)
+		require.Equal(t, "hello\n", line)
+		remoteAddr := <-remoteAddrs
+		if c.expected == "" {
+			c.expected = conn.LocalAddr().String()
+		}
+		require.Equal(t, c.expected, remoteAddr)
+		conn.Close()
+	}
+
+	for _, header := range [][]byte{
+		makeProxyHeaderV2(0x11, 0x11, []byte{192, 168, 0, 1, 192, 168, 0, 11, 0xDC, 0x04, 0x01, 0xBB}),
+		makeProxyHeaderV2(0x22, 0x11, []byte{192, 168, 0, 1, 192, 168, 0, 11, 0xDC, 0x04, 0x01, 0xBB}),
+		makeProxyHeaderV2(0x21, 0x11, []byte{192, 168, 0, 1, 192, 168, 0, 11, 0xDC, 0x04, 0x01}),
+		makeProxyHeaderV2(0x21, 0x11, []byte{192, 168, 0, 1, 192, 168, 0, 11, 0xDC, 0x04, 0x01, 0xBB, 0x01, 0x00}),
+	} {
+		conn, err := net.Dial("tcp", addr)
+		require.Nil(t, err)
+		_, err = conn.Write(append(header, "hello\n"...))
+		require.Nil(t, err)
+		_, err = bufio.NewReader(conn).ReadString('\n')
+		require.Equal(t, io.EOF, err)
+		conn.Close()
+	}
+}
+
+func TestProxyProtoConn_TLVs(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewProxyProtoConn(server, makeProxyProtoOptions())
+	defer conn.Close()
+
+	go client.Write(makeProxyHeaderV2(0x21, 0x12, append([]byte{10, 0, 0, 1, 10, 0, 0, 2, 0x00, 0x35, 0x00, 0x35},
+		ProxyTLVTypeALPN, 0x00, 0x02, 'h', '2', ProxyTLVTypeNoop, 0x00, 0x00)))
+	header, err := conn.Header()
+	require.Nil(t, err)
+	require.Equal(t, &ProxyHeader{
+		Version:         2,
+		Command:         ProxyCommandProxy,
+		SourceAddr:      &net.UDPAddr{IP: net.IP{10, 0, 0, 1}, Port: 53},
+		DestinationAddr: &net.UDPAddr{IP: net.IP{10, 0, 0, 2}, Port: 53},
+		TLVs: []ProxyTLV{
+			{Type: ProxyTLVTypeALPN, Value: []byte("h2")},
+			{Type: ProxyTLVTypeNoop, Value: []byte{}},
+		},
+	}, header)
+	require.Equal(t, "10.0.0.2:53", conn.LocalAddr().String())
+}
+
+func TestProxyProtoListener_Options(t *testing.T) {
+	trusted, err := ParseIPSet("10.0.0.0/8")
+	require.Nil(t, err)
+	addr, remoteAddrs, closeFn := startProxyProtoServer(t, WithTrustedUpstreams(trusted))
+	{ // Untrusted upstream, the header is not parsed.
+		conn, err := net.Dial("tcp", addr)
+		require.Nil(t, err)
+		_, err = conn.Write([]byte("PROXY UNKNOWN\r\nhello\n"))
+		require.Nil(t, err)
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		require.Nil(t, err)
+		require.Equal(t, "PROXY UNKNOWN\r\n", line)
+		require.Equal(t, conn.LocalAddr().String(), <-remoteAddrs)
+		conn.Close()
+	}
+	closeFn()
+
+	addr, _, closeFn = startProxyProtoServer(t, WithProxyHeaderRequired(),
+		WithProxyHeaderTimeout(20*time.Millisecond))
+	defer closeFn()
+	for _, data := range []string{"hello\n", "PROX"} {
+		conn, err := net.Dial("tcp", addr)
+		require.Nil(t, err)
+		_, err = conn.Write([]byte(data))
+		require.Nil(t, err)
+		_, err = bufio.NewReader(conn).ReadString('\n')
+		require.Equal(t, io.EOF, err)
+		conn.Close()
+	}
+}
+
+func TestProxyProtoConn_ServerFirst(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewProxyProtoConn(server, makeProxyProtoOptions(WithProxyHeaderTimeout(20*time.Millisecond)))
+	defer conn.Close()
+
+	header, err := conn.Header()
+	require.Nil(t, err)
+	require.Nil(t, header)
+	go client.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(buf))
+}
+
+func TestProxyProtoConn_PartialSignature(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewProxyProtoConn(server, makeProxyProtoOptions(WithProxyHeaderTimeout(20*time.Millisecond)))
+	defer conn.Close()
+
+	go client.Write([]byte("PR"))
+	header, err := conn.Header()
+	require.Nil(t, err)
+	require.Nil(t, header)
+	go client.Write([]byte("INT"))
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	require.Nil(t, err)
+	require.Equal(t, "PRINT", string(buf))
+}
+
+func TestProxyProtoConn_KeepReadDeadline(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	conn := NewProxyProtoConn(server, makeProxyProtoOptions(WithProxyHeaderTimeout(time.Second)))
+	defer conn.Close()
+
+	require.Nil(t, conn.SetReadDeadline(time.Now().Add(50*time.Millisecond)))
+	go client.Write([]byte("PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"))
+	header, err := conn.Header()
+	require.Nil(t, err)
+	require.Equal(t, "192.168.0.1:56324", header.SourceAddr.String())
+
+	start := time.Now()
+	_, err = conn.Read(make([]byte, 1))
+	var nerr net.Error
+	require.True(t, errors.As(err, &nerr) && nerr.Timeout(), "%v", err)
+	require.True(t, time.Since(start) < 500*time.Millisecond)
+}
+
+func startProxyProtoServer(t *testing.T, opts ...WithProxyProtoOption) (string, <-chan string, func()) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	remoteAddrs := make(chan string, 1)
+	s := NewServerFromListener(NewProxyProtoListener(l, opts...), func(_ context.Context, conn net.Conn) {
+		defer conn.Close()
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		if err != nil {
+			return
+		}
+		remoteAddrs <- conn.RemoteAddr().String()
+		_, _ = conn.Write([]byte(line))
+	})
+	go s.Serve()
+	return l.Addr().String(), remoteAddrs, func() { s.Close() }
+}
+
+func makeProxyHeaderV2(verCmd, famProto byte, payload []byte) []byte {
+	buf := &bytes.Buffer{}
+	buf.Write(proxyV2Signature)
+	buf.WriteByte(verCmd)
+	buf.WriteByte(famProto)
+	_ = binary.Write(buf, binary.BigEndian, uint16(len(payload)))
+	buf.Write(payload)
+	return buf.Bytes()
+}
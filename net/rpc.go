@@ -0,0 +1,437 @@
+package net
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+)
+
+var (
+	ErrRPCClientClosed     = errors.New("libext-go/net: rpc client closed")
+	ErrRPCPayloadTooLarge  = errors.New("libext-go/net: rpc payload too large")
+	ErrUnknownRPCMethod    = errors.New("libext-go/net: unknown rpc method")
+	ErrInvalidRPCFrameType = errors.New("libext-go/net: invalid rpc frame type")
+)
+
+// The frame layout(big endian): type(1) + status(1) + method(2) + request id(4) +
+// payload length(4) + payload.
+const (
+	rpcHeaderSize = 12
+
+	rpcFrameRequest  = 1
+	rpcFrameResponse = 2
+
+	rpcStatusOK            = 0
+	rpcStatusError         = 1
+	rpcStatusUnknownMethod = 2
+
+	defaultRPCMaxPayloadSize = 16 * 1024 * 1024
+	defaultRPCCallTimeout    = 30 * time.Second
+)
+
+// RPCError is the error returned by the remote handler.
+type RPCError struct {
+	Method  uint16
+	Message string
+}
+
+func (e *RPCError) Error() string {
+	return "libext-go/net: rpc error: " + e.Message
+}
+
+// RPCHandler handles the request payload and returns the response payload,
+// the payloads are usually encoded by encoding/binary.
+type RPCHandler func(ctx context.Context, req []byte) ([]byte, error)
+
+type (
+	RPCOptions struct {
+		maxPayloadSize uint32
+		callTimeout    time.Duration
+		handleTimeout  time.Duration
+	}
+	WithRPCOption func(opts *RPCOptions)
+)
+
+// WithRPCMaxPayloadSize limits the payload size of a frame, the connection is
+// closed if a larger frame is received.
+func WithRPCMaxPayloadSize(size uint32) WithRPCOption {
+	return func(opts *RPCOptions) {
+		opts.maxPayloadSize = size
+	}
+}
+
+// WithRPCCallTimeout sets the timeout of each call if the context has no deadline,
+// zero means no timeout. It is for the client only.
+func WithRPCCallTimeout(timeout time.Duration) WithRPCOption {
+	return func(opts *RPCOptions) {
+		opts.callTimeout = timeout
+	}
+}
+
+// WithRPCHandleTimeout sets the timeout of the context passed to the handlers,
+// zero means no timeout. It is for the server only.
+func WithRPCHandleTimeout(timeout time.Duration) WithRPCOption {
+	return func(opts *RPCOptions) {
+		opts.handleTimeout = timeout
+	}
+}
+
+var _defaultRPCOptions = []WithRPCOption{
+	WithRPCMaxPayloadSize(defaultRPCMaxPayloadSize),
+	WithRPCCallTimeout(defaultRPCCallTimeout),
+}
+
+func makeRPCOptions(opts ...WithRPCOption) RPCOptions {
+	var rpcOpts RPCOptions
+	for _, opt := range _defaultRPCOptions {
+		opt(&rpcOpts)
+	}
+	for _, opt := range opts {
+		opt(&rpcOpts)
+	}
+	return rpcOpts
+}
+
+type rpcFrame struct {
+	typ     uint8
+	status  uint8
+	method  uint16
+	id      uint32
+	payload []byte
+}
+
+func readRPCFrame(r io.Reader, maxPayloadSize uint32) (rpcFrame, error) {
+	var hdr [rpcHeaderSize]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return rpcFrame{}, err
+	}
+	f := rpcFrame{
+		typ:    hdr[0],
+		status: hdr[1],
+		method: binary.BigEndian.Uint16(hdr[2:4]),
+		id:     binary.BigEndian.Uint32(hdr[4:8]),
+	}
+	size := binary.BigEndian.Uint32(hdr[8:12])
+	if size > maxPayloadSize {
+		return rpcFrame{}, ErrRPCPayloadTooLarge
+	}
+	if size > 0 {
+		f.payload = make([]byte, size)
+		if _, err := io.ReadFull(r, f.payload); err != nil {
+			return rpcFrame{}, err
+		}
+	}
+	return f, nil
+}
+
+var _aLongTimeAgo = time.Unix(1, 0) //nolint:gochecknoglobals
+
+// rpcFrameWriter writes frames from multiple goroutines.
+type rpcFrameWriter struct {
+	mu   sync.Mutex
+	conn *rpcCountingConn
+	w    *bufio.Writer
+}
+
+// rpcCountingConn counts the bytes written into the conn.
+type rpcCountingConn struct {
+	net.Conn
+	n int64
+}
+
+func (c *rpcCountingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func newRPCFrameWriter(conn net.Conn) *rpcFrameWriter {
+	cc := &rpcCountingConn{Conn: conn}
+	return &rpcFrameWriter{conn: cc, w: bufio.NewWriter(cc)}
+}
+
+func (fw *rpcFrameWriter) write(f rpcFrame) error {
+	_, err := fw.writeContext(context.Background(), f)
+	return err
+}
+
+// writeContext writes the frame, the writing is bounded by the deadline of the
+// context and interrupted once the context is done, nothing is written if the
+// context is done before the writing starts. The partial reports whether the
+// frame is partially written if it fails, the conn must be closed in that case.
+func (fw *rpcFrameWriter) writeContext(ctx context.Context, f rpcFrame) (partial bool, err error) {
+	var hdr [rpcHeaderSize]byte
+	hdr[0] = f.typ
+	hdr[1] = f.status
+	binary.BigEndian.PutUint16(hdr[2:4], f.method)
+	binary.BigEndian.PutUint32(hdr[4:8], f.id)
+	binary.BigEndian.PutUint32(hdr[8:12], uint32(len(f.payload)))
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	deadline, _ := ctx.Deadline()
+	if err := fw.conn.SetWriteDeadline(deadline); err != nil {
+		return false, err
+	}
+	if ctx.Done() != nil {
+		stopc := make(chan struct{})
+		exitc := make(chan struct{})
+		go func() {
+			defer close(exitc)
+			select {
+			case <-ctx.Done():
+				_ = fw.conn.SetWriteDeadline(_aLongTimeAgo)
+			case <-stopc:
+			}
+		}()
+		defer func() { // Wait for it, otherwise it may interrupt the next writing.
+			close(stopc)
+			<-exitc
+		}()
+	}
+
+	written := fw.conn.n
+	defer func() {
+		if err == nil {
+			return
+		}
+		if partial = fw.conn.n != written; !partial {
+			fw.w.Reset(fw.conn) // Drops the buffered frame and the sticky error.
+		}
+	}()
+	if _, err := fw.w.Write(hdr[:]); err != nil {
+		return false, err
+	}
+	if _, err := fw.w.Write(f.payload); err != nil {
+		return false, err
+	}
+	return false, fw.w.Flush()
+}
+
+// RPCServer dispatches the requests to the handlers keyed by method ID, the
+// requests on a connection are handled concurrently and the responses are
+// written once ready, so they may be out of order.
+type RPCServer struct {
+	opts RPCOptions
+
+	mu       sync.RWMutex
+	handlers map[uint16]RPCHandler
+}
+
+// NewRPCServer creates a RPCServer, the HandleConn can be used as the ConnHandleFunc.
+func NewRPCServer(opts ...WithRPCOption) *RPCServer {
+	return &RPCServer{
+		opts:     makeRPCOptions(opts...),
+		handlers: make(map[uint16]RPCHandler),
+	}
+}
+
+// Register registers the handler for the method, the old one is replaced.
+func (s *RPCServer) Register(method uint16, handler RPCHandler) {
+	s.mu.Lock()
+	s.handlers[method] = handler
+	s.mu.Unlock()
+}
+
+// HandleConn serves the requests on the conn until the conn is closed or the
+// reading fails(e.g. the peer half-closes), the conn is closed after the in-flight
+// requests are done. It is closed immediately if the context is done or a write
+// fails, the in-flight handlers see the context canceled then.
+func (s *RPCServer) HandleConn(ctx context.Context, conn net.Conn) {
+	ctx, cancel := context.WithCancel(ctx)
+	stopc := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		wg.Wait()
+		close(stopc)
+		cancel()
+		_ = conn.Close()
+	}()
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close() // Unblock the reading and writing.
+		case <-stopc:
+		}
+	}()
+
+	r := bufio.NewReader(conn)
+	w := newRPCFrameWriter(conn)
+	for {
+		f, err := readRPCFrame(r, s.opts.maxPayloadSize)
+		if err != nil || f.typ != rpcFrameRequest {
+			return
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := w.write(s.handle(ctx, f)); err != nil {
+				cancel()
+			}
+		}()
+	}
+}
+
+func (s *RPCServer) handle(ctx context.Context, req rpcFrame) rpcFrame {
+	resp := rpcFrame{typ: rpcFrameResponse, method: req.method, id: req.id}
+	s.mu.RLock()
+	handler, ok := s.handlers[req.method]
+	s.mu.RUnlock()
+	if !ok {
+		resp.status = rpcStatusUnknownMethod
+		return resp
+	}
+
+	if s.opts.handleTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.opts.handleTimeout)
+		defer cancel()
+	}
+	payload, err := handler(ctx, req.payload)
+	if err != nil {
+		resp.status = rpcStatusError
+		resp.payload = []byte(err.Error())
+	} else {
+		resp.payload = payload
+	}
+	if uint32(len(resp.payload)) > s.opts.maxPayloadSize {
+		resp.status = rpcStatusError
+		resp.payload = []byte(ErrRPCPayloadTooLarge.Error())
+	}
+	return resp
+}
+
+// RPCClient multiplexes concurrent calls over one connection.
+type RPCClient struct {
+	conn   net.Conn
+	opts   RPCOptions
+	w      *rpcFrameWriter
+	nextID *atomic.Uint32
+
+	mu      sync.Mutex
+	pending map[uint32]chan rpcFrame
+	err     error
+
+	closeOnce sync.Once
+	donec     chan struct{}
+}
+
+// NewRPCClient creates a RPCClient over the conn.
+func NewRPCClient(conn net.Conn, opts ...WithRPCOption) *RPCClient {
+	c := &RPCClient{
+		conn:    conn,
+		opts:    makeRPCOptions(opts...),
+		w:       newRPCFrameWriter(conn),
+		nextID:  atomic.NewUint32(0),
+		pending: make(map[uint32]chan rpcFrame),
+		donec:   make(chan struct{}),
+	}
+	go c.readLoop()
+	return c
+}
+
+// Call calls the method and waits for the response, the call is abandoned
+// if the context is done, the response arrives later is dropped.
+func (c *RPCClient) Call(ctx context.Context, method uint16, req []byte) ([]byte, error) {
+	if uint32(len(req)) > c.opts.maxPayloadSize {
+		return nil, ErrRPCPayloadTooLarge
+	}
+	if _, ok := ctx.Deadline(); !ok && c.opts.callTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.callTimeout)
+		defer cancel()
+	}
+
+	id := c.nextID.Inc()
+	respc := make(chan rpcFrame, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	c.pending[id] = respc
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if partial, err := c.w.writeContext(ctx, rpcFrame{typ: rpcFrameRequest, method: method, id: id, payload: req}); err != nil {
+		if partial { // The conn is broken.
+			c.closeWithError(err)
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+
+	select {
+	case resp := <-respc:
+		switch resp.status {
+		case rpcStatusOK:
+			return resp.payload, nil
+		case rpcStatusUnknownMethod:
+			return nil, ErrUnknownRPCMethod
+		default:
+			return nil, &RPCError{Method: method, Message: string(resp.payload)}
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.donec:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return nil, c.err
+	}
+}
+
+// Close closes the client and the conn, the pending calls fail with ErrRPCClientClosed.
+func (c *RPCClient) Close() error {
+	c.closeWithError(ErrRPCClientClosed)
+	return nil
+}
+
+func (c *RPCClient) closeWithError(err error) {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.err = err
+		c.mu.Unlock()
+		close(c.donec)
+		_ = c.conn.Close()
+	})
+}
+
+func (c *RPCClient) readLoop() {
+	r := bufio.NewReader(c.conn)
+	for {
+		f, err := readRPCFrame(r, c.opts.maxPayloadSize)
+		if err == nil && f.typ != rpcFrameResponse {
+			err = ErrInvalidRPCFrameType
+		}
+		if err != nil {
+			c.closeWithError(err)
+			return
+		}
+
+		c.mu.Lock()
+		respc, ok := c.pending[f.id]
+		c.mu.Unlock()
+		if ok {
+			select {
+			case respc <- f:
+			default: // Duplicated response.
+			}
+		}
+	}
+}
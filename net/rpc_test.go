@@ -0,0 +1,220 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	binaryext "github.com/damnever/libext-go/encoding/binary"
+)
+
+func TestRPC(t *testing.T) {
+	const (
+		methodEcho uint16 = iota + 1
+		methodSleep
+		methodFail
+	)
+	rs := NewRPCServer(WithRPCHandleTimeout(time.Second))
+	rs.Register(methodEcho, func(_ context.Context, req []byte) ([]byte, error) {
+		return req, nil
+	})
+	rs.Register(methodSleep, func(ctx context.Context, req []byte) ([]byte, error) {
+		var ms uint32
+		if err := binaryext.NewBigEndianReader(bytes.NewReader(req)).ReadUint32(&ms); err != nil {
+			return nil, err
+		}
+		select {
+		case <-time.After(time.Duration(ms) * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return req, nil
+	})
+	rs.Register(methodFail, func(context.Context, []byte) ([]byte, error) {
+		return nil, errors.New("failed")
+	})
+
+	l := NewMemListener("rpc")
+	s := NewServerFromListener(l, rs.HandleConn)
+	go s.Serve()
+	defer s.Close()
+	conn, err := l.Dial()
+	require.Nil(t, err)
+	c := NewRPCClient(conn)
+	defer c.Close()
+	ctx := context.Background()
+
+	resp, err := c.Call(ctx, methodEcho, []byte("hello"))
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(resp))
+	_, err = c.Call(ctx, 100, nil)
+	require.Equal(t, ErrUnknownRPCMethod, err)
+	_, err = c.Call(ctx, methodFail, nil)
+	require.Equal(t, &RPCError{Method: methodFail, Message: "failed"}, err)
+
+	sleepReq := func(ms uint32) []byte {
+		buf := &bytes.Buffer{}
+		require.Nil(t, binaryext.NewBigEndianWriter(buf).WriteUint32(ms))
+		return buf.Bytes()
+	}
+	// The responses are out of order.
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	for _, ms := range []uint32{60, 0, 30} {
+		ms := ms
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.Call(ctx, methodSleep, sleepReq(ms))
+			require.Nil(t, err)
+			mu.Lock()
+			order = append(order, fmt.Sprint(ms))
+			mu.Unlock()
+		}()
+		time.Sleep(5 * time.Millisecond)
+	}
+	wg.Wait()
+	require.Equal(t, []string{"0", "30", "60"}, order)
+
+	tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	_, err = c.Call(tctx, methodSleep, sleepReq(100))
+	cancel()
+	require.Equal(t, context.DeadlineExceeded, err)
+	resp, err = c.Call(ctx, methodEcho, []byte("still works"))
+	require.Nil(t, err)
+	require.Equal(t, "still works", string(resp))
+
+	require.Nil(t, c.Close())
+	_, err = c.Call(ctx, methodEcho, nil)
+	require.Equal(t, ErrRPCClientClosed, err)
+}
+
+func TestRPCPayloadTooLarge(t *testing.T) {
+	rs := NewRPCServer(WithRPCMaxPayloadSize(4))
+	c1, c2 := MemPipe()
+	go rs.HandleConn(context.Background(), c2)
+	c := NewRPCClient(c1)
+	defer c.Close()
+
+	_, err := c.Call(context.Background(), 1, []byte("12345"))
+	require.NotNil(t, err)
+	<-c.donec // The server closes the conn.
+}
+
+func TestRPCServerHalfClose(t *testing.T) {
+	const n = 10
+	rs := NewRPCServer()
+	rs.Register(1, func(ctx context.Context, req []byte) ([]byte, error) {
+		select {
+		case <-time.After(20 * time.Millisecond):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return req, nil
+	})
+	c1, c2 := MemPipe()
+	defer c1.Close()
+	donec := make(chan struct{})
+	go func() {
+		rs.HandleConn(context.Background(), c2)
+		close(donec)
+	}()
+
+	w := newRPCFrameWriter(c1)
+	for i := uint32(1); i <= n; i++ {
+		require.Nil(t, w.write(rpcFrame{typ: rpcFrameRequest, method: 1, id: i, payload: []byte(fmt.Sprint(i))}))
+	}
+	require.Nil(t, c1.(interface{ CloseWrite() error }).CloseWrite())
+
+	ids := map[uint32]bool{}
+	for i := 0; i < n; i++ {
+		f, err := readRPCFrame(c1, defaultRPCMaxPayloadSize)
+		require.Nil(t, err)
+		require.Equal(t, uint8(rpcStatusOK), f.status, string(f.payload))
+		require.Equal(t, fmt.Sprint(f.id), string(f.payload))
+		ids[f.id] = true
+	}
+	require.Len(t, ids, n)
+	<-donec
+}
+
+func TestRPCClientWriteBlocked(t *testing.T) {
+	c1, c2 := MemPipe(WithMemPipeBufferSize(1024))
+	defer c2.Close() // Never reads.
+	c := NewRPCClient(c1, WithRPCCallTimeout(50*time.Millisecond))
+	defer c.Close()
+
+	errc := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := c.Call(context.Background(), 1, make([]byte, 64*1024))
+			errc <- err
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case err := <-errc:
+			require.NotNil(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("call blocked by the writing")
+		}
+	}
+	_, err := c.Call(context.Background(), 1, nil)
+	require.NotNil(t, err)
+}
+
+func TestRPCClientCanceledCall(t *testing.T) {
+	rs := NewRPCServer()
+	rs.Register(1, func(_ context.Context, req []byte) ([]byte, error) {
+		return req, nil
+	})
+	l := NewMemListener("rpc")
+	s := NewServerFromListener(l, rs.HandleConn)
+	go s.Serve()
+	defer s.Close()
+	conn, err := l.Dial()
+	require.Nil(t, err)
+	c := NewRPCClient(conn)
+	defer c.Close()
+
+	// The calls wait for the writer, one of them expires in the meantime.
+	c.w.mu.Lock()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	errc := make(chan error, 9)
+	go func() {
+		_, err := c.Call(ctx, 1, []byte("expired"))
+		errc <- err
+	}()
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			req := []byte(fmt.Sprint(i))
+			resp, err := c.Call(context.Background(), 1, req)
+			if err == nil && !bytes.Equal(req, resp) {
+				err = fmt.Errorf("unexpected response: %q", resp)
+			}
+			errc <- err
+		}(i)
+	}
+	<-ctx.Done()
+	c.w.mu.Unlock()
+
+	canceled := 0
+	for i := 0; i < 9; i++ {
+		if err := <-errc; err != nil {
+			require.Equal(t, context.DeadlineExceeded, err)
+			canceled++
+		}
+	}
+	require.Equal(t, 1, canceled)
+	resp, err := c.Call(context.Background(), 1, []byte("hello"))
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(resp))
+}
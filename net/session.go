@@ -0,0 +1,852 @@
+package net
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	ErrSessionClosed      = errors.New("libext-go/net: session closed")
+	ErrSessionGoAway      = errors.New("libext-go/net: remote end is not accepting streams")
+	ErrSessionProtocol    = errors.New("libext-go/net: session protocol error")
+	ErrKeepAliveTimeout   = errors.New("libext-go/net: keepalive timeout")
+	ErrStreamsExhausted   = errors.New("libext-go/net: stream ids exhausted")
+	ErrStreamClosed       = errors.New("libext-go/net: stream closed")
+	ErrStreamReset        = errors.New("libext-go/net: stream reset by peer")
+	ErrInvalidFrameHeader = errors.New("libext-go/net: invalid frame header")
+)
+
+// The frame header: version(1) + type(1) + flags(2) + stream id(4) + length(4),
+// the length is the payload size for data frames, the window delta for window
+// update frames, the opaque value for ping frames and the code for go away frames.
+const (
+	frameVersion    = 0
+	frameHeaderSize = 12
+
+	frameTypeData         = 0
+	frameTypeWindowUpdate = 1
+	frameTypePing         = 2
+	frameTypeGoAway       = 3
+
+	frameFlagSYN = 1 << 0
+	frameFlagACK = 1 << 1
+	frameFlagFIN = 1 << 2
+	frameFlagRST = 1 << 3
+
+	goAwayNormal = 0
+
+	initialStreamWindow = 256 * 1024
+	maxDataFrameSize    = 64 * 1024
+
+	defaultSessionAcceptBacklog = 256
+	defaultKeepAliveInterval    = 30 * time.Second
+	defaultKeepAliveTimeout     = 10 * time.Second
+)
+
+type frameHeader [frameHeaderSize]byte
+
+func makeFrameHeader(typ uint8, flags uint16, streamID uint32, length uint32) frameHeader {
+	var hdr frameHeader
+	hdr[0] = frameVersion
+	hdr[1] = typ
+	binary.BigEndian.PutUint16(hdr[2:4], flags)
+	binary.BigEndian.PutUint32(hdr[4:8], streamID)
+	binary.BigEndian.PutUint32(hdr[8:12], length)
+	return hdr
+}
+
+func (hdr frameHeader) typ() uint8       { return hdr[1] }
+func (hdr frameHeader) flags() uint16    { return binary.BigEndian.Uint16(hdr[2:4]) }
+func (hdr frameHeader) streamID() uint32 { return binary.BigEndian.Uint32(hdr[4:8]) }
+func (hdr frameHeader) length() uint32   { return binary.BigEndian.Uint32(hdr[8:12]) }
+
+type (
+	SessionOptions struct {
+		acceptBacklog     int
+		streamWindow      uint32
+		keepAliveInterval time.Duration
+		keepAliveTimeout  time.Duration
+	}
+	WithSessionOption func(opts *SessionOptions)
+)
+
+// WithSessionAcceptBacklog sets the number of streams opened by the remote end
+// which are waiting to be accepted, the new streams are reset if it is full.
+func WithSessionAcceptBacklog(backlog int) WithSessionOption {
+	return func(opts *SessionOptions) {
+		opts.acceptBacklog = backlog
+	}
+}
+
+// WithSessionStreamWindow sets the receive window size of each stream,
+// the value less than the initial window(256KB) is ignored.
+func WithSessionStreamWindow(size uint32) WithSessionOption {
+	return func(opts *SessionOptions) {
+		if size < initialStreamWindow {
+			size = initialStreamWindow
+		}
+		opts.streamWindow = size
+	}
+}
+
+// WithSessionKeepAlive sets the interval and timeout of keepalive pings,
+// a zero interval disables the keepalive.
+func WithSessionKeepAlive(interval, timeout time.Duration) WithSessionOption {
+	return func(opts *SessionOptions) {
+		opts.keepAliveInterval = interval
+		opts.keepAliveTimeout = timeout
+	}
+}
+
+var _defaultSessionOptions = []WithSessionOption{
+	WithSessionAcceptBacklog(defaultSessionAcceptBacklog),
+	WithSessionStreamWindow(initialStreamWindow),
+	WithSessionKeepAlive(defaultKeepAliveInterval, defaultKeepAliveTimeout),
+}
+
+func makeSessionOptions(opts ...WithSessionOption) SessionOptions {
+	var sessOpts SessionOptions
+	for _, opt := range _defaultSessionOptions {
+		opt(&sessOpts)
+	}
+	for _, opt := range opts {
+		opt(&sessOpts)
+	}
+	return sessOpts
+}
+
+type sendRequest struct {
+	hdr  frameHeader
+	body []byte
+	errc chan error
+}
+
+// Session multiplexes logical streams over a single net.Conn, each stream is
+// a net.Conn with its own flow-control window. The Session implements
+// net.Listener, so the streams opened by the remote end can be served by
+// NewServerFromListener as if they were connections.
+//
+// Streams opened by the client side have odd ids, the server side even ones.
+type Session struct {
+	conn     net.Conn
+	opts     SessionOptions
+	isClient bool
+
+	mu           sync.Mutex
+	streams      map[uint32]*Stream
+	nextStreamID uint32
+	localGoAway  bool
+	remoteGoAway bool
+	pings        map[uint32]chan struct{}
+	nextPingID   uint32
+
+	acceptc chan *Stream
+	sendc   chan *sendRequest
+
+	ctrlMu     sync.Mutex
+	ctrlFrames []frameHeader
+	ctrlNotify chan struct{}
+
+	closeOnce sync.Once
+	closeErr  error
+	closec    chan struct{}
+}
+
+// NewClientSession creates a client side Session over the conn.
+func NewClientSession(conn net.Conn, opts ...WithSessionOption) *Session {
+	return newSession(conn, true, opts...)
+}
+
+// NewServerSession creates a server side Session over the conn.
+func NewServerSession(conn net.Conn, opts ...WithSessionOption) *Session {
+	return newSession(conn, false, opts...)
+}
+
+func newSession(conn net.Conn, isClient bool, opts ...WithSessionOption) *Session {
+	sessOpts := makeSessionOptions(opts...)
+	s := &Session{
+		conn:       conn,
+		opts:       sessOpts,
+		isClient:   isClient,
+		streams:    make(map[uint32]*Stream),
+		pings:      make(map[uint32]chan struct{}),
+		acceptc:    make(chan *Stream, sessOpts.acceptBacklog),
+		sendc:      make(chan *sendRequest),
+		ctrlNotify: make(chan struct{}, 1),
+		closec:     make(chan struct{}),
+	}
+	if isClient {
+		s.nextStreamID = 1
+	} else {
+		s.nextStreamID = 2
+	}
+
+	go s.recvLoop()
+	go s.sendLoop()
+	if sessOpts.keepAliveInterval > 0 {
+		go s.keepAliveLoop()
+	}
+	return s
+}
+
+// OpenStream opens a new stream, it does not wait for the remote end to accept it.
+func (s *Session) OpenStream() (*Stream, error) {
+	s.mu.Lock()
+	if s.isClosed() {
+		s.mu.Unlock()
+		return nil, ErrSessionClosed
+	}
+	if s.remoteGoAway {
+		s.mu.Unlock()
+		return nil, ErrSessionGoAway
+	}
+	id := s.nextStreamID
+	if id >= math.MaxUint32-1 {
+		s.mu.Unlock()
+		return nil, ErrStreamsExhausted
+	}
+	s.nextStreamID += 2
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	s.sendWindowUpdate(id, frameFlagSYN, s.opts.streamWindow-initialStreamWindow)
+	return st, nil
+}
+
+// Open opens a new stream as a net.Conn.
+func (s *Session) Open() (net.Conn, error) {
+	st, err := s.OpenStream()
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// AcceptStream waits for the next stream opened by the remote end.
+func (s *Session) AcceptStream() (*Stream, error) {
+	select {
+	case st := <-s.acceptc:
+		return st, nil
+	case <-s.closec:
+		return nil, ErrSessionClosed
+	}
+}
+
+// Accept implements net.Listener.
+func (s *Session) Accept() (net.Conn, error) {
+	st, err := s.AcceptStream()
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// Addr implements net.Listener, it returns the local address of the underlying conn.
+func (s *Session) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// NumStreams returns the number of alive streams.
+func (s *Session) NumStreams() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.streams)
+}
+
+// GoAway tells the remote end to stop opening new streams, the existing
+// streams are not affected.
+func (s *Session) GoAway() error {
+	s.mu.Lock()
+	s.localGoAway = true
+	s.mu.Unlock()
+	return s.send(makeFrameHeader(frameTypeGoAway, 0, 0, goAwayNormal), nil, nil)
+}
+
+// Ping sends a ping to the remote end and returns the round-trip time.
+func (s *Session) Ping() (time.Duration, error) {
+	s.mu.Lock()
+	id := s.nextPingID
+	s.nextPingID++
+	ch := make(chan struct{})
+	s.pings[id] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pings, id)
+		s.mu.Unlock()
+	}()
+
+	var timeoutc <-chan time.Time
+	if s.opts.keepAliveTimeout > 0 {
+		timer := time.NewTimer(s.opts.keepAliveTimeout)
+		defer timer.Stop()
+		timeoutc = timer.C
+	}
+
+	start := time.Now()
+	s.queueControl(makeFrameHeader(frameTypePing, frameFlagSYN, 0, id))
+	select {
+	case <-ch:
+		return time.Since(start), nil
+	case <-timeoutc:
+		return 0, ErrKeepAliveTimeout
+	case <-s.closec:
+		return 0, ErrSessionClosed
+	}
+}
+
+// CloseChan returns a channel which is closed after the Session is closed.
+func (s *Session) CloseChan() <-chan struct{} {
+	return s.closec
+}
+
+// Err returns the reason why the Session is closed, it is nil if not closed.
+func (s *Session) Err() error {
+	select {
+	case <-s.closec:
+		return s.closeErr
+	default:
+		return nil
+	}
+}
+
+// Close closes the Session and the underlying conn, all streams are closed as well.
+func (s *Session) Close() error {
+	if !s.closeWithError(ErrSessionClosed) {
+		return ErrSessionClosed
+	}
+	return nil
+}
+
+func (s *Session) isClosed() bool {
+	return isClosedChan(s.closec)
+}
+
+func (s *Session) closeWithError(err error) bool {
+	closed := false
+	s.closeOnce.Do(func() {
+		s.closeErr = err
+		close(s.closec)
+		_ = s.conn.Close()
+		closed = true
+
+		s.mu.Lock()
+		streams := make([]*Stream, 0, len(s.streams))
+		for _, st := range s.streams {
+			streams = append(streams, st)
+		}
+		s.mu.Unlock()
+		for _, st := range streams {
+			st.notifyAll()
+		}
+	})
+	return closed
+}
+
+func (s *Session) keepAliveLoop() {
+	ticker := time.NewTicker(s.opts.keepAliveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := s.Ping(); err != nil {
+				if errors.Is(err, ErrKeepAliveTimeout) {
+					s.closeWithError(err)
+				}
+				return
+			}
+		case <-s.closec:
+			return
+		}
+	}
+}
+
+// send sends a frame and waits for it to be written, the deadline is optional.
+func (s *Session) send(hdr frameHeader, body []byte, deadline <-chan struct{}) error {
+	req, err := s.handoff(hdr, body, deadline)
+	if err != nil {
+		return err
+	}
+	return s.waitSent(req)
+}
+
+// handoff hands a frame to the sender, the frame is not sent if it fails.
+func (s *Session) handoff(hdr frameHeader, body []byte, deadline <-chan struct{}) (*sendRequest, error) {
+	req := &sendRequest{hdr: hdr, body: body, errc: make(chan error, 1)}
+	select {
+	case s.sendc <- req:
+		return req, nil
+	case <-deadline:
+		return nil, errTimeout
+	case <-s.closec:
+		return nil, ErrSessionClosed
+	}
+}
+
+// waitSent waits for the frame handed off to be written.
+func (s *Session) waitSent(req *sendRequest) error {
+	select {
+	case err := <-req.errc:
+		return err
+	case <-s.closec:
+		return ErrSessionClosed
+	}
+}
+
+// queueControl queues a control frame without blocking, the control frames
+// are written before any data frames queued after them.
+func (s *Session) queueControl(hdr frameHeader) {
+	s.ctrlMu.Lock()
+	s.ctrlFrames = append(s.ctrlFrames, hdr)
+	s.ctrlMu.Unlock()
+	select {
+	case s.ctrlNotify <- struct{}{}:
+	default:
+	}
+}
+
+func (s *Session) sendWindowUpdate(id uint32, flags uint16, delta uint32) {
+	s.queueControl(makeFrameHeader(frameTypeWindowUpdate, flags, id, delta))
+}
+
+func (s *Session) flushControl() error {
+	s.ctrlMu.Lock()
+	frames := s.ctrlFrames
+	s.ctrlFrames = nil
+	s.ctrlMu.Unlock()
+	if len(frames) == 0 {
+		return nil
+	}
+
+	buf := make([]byte, 0, len(frames)*frameHeaderSize)
+	for _, hdr := range frames {
+		buf = append(buf, hdr[:]...)
+	}
+	_, err := s.conn.Write(buf)
+	return err
+}
+
+func (s *Session) sendLoop() {
+	for {
+		if err := s.flushControl(); err != nil {
+			s.closeWithError(err)
+			return
+		}
+
+		select {
+		case <-s.ctrlNotify:
+		case req := <-s.sendc:
+			// The control frames, e.g. SYN, must go first.
+			err := s.flushControl()
+			if err == nil {
+				bufs := net.Buffers{req.hdr[:], req.body}
+				_, err = bufs.WriteTo(s.conn)
+			}
+			req.errc <- err
+			if err != nil {
+				s.closeWithError(err)
+				return
+			}
+		case <-s.closec:
+			return
+		}
+	}
+}
+
+func (s *Session) recvLoop() {
+	var hdr frameHeader
+	for {
+		if _, err := io.ReadFull(s.conn, hdr[:]); err != nil {
+			s.closeWithError(err)
+			return
+		}
+		if hdr[0] != frameVersion {
+			s.closeWithError(ErrInvalidFrameHeader)
+			return
+		}
+
+		var err error
+		switch hdr.typ() {
+		case frameTypeData, frameTypeWindowUpdate:
+			err = s.handleStreamFrame(hdr)
+		case frameTypePing:
+			s.handlePing(hdr)
+		case frameTypeGoAway:
+			s.mu.Lock()
+			s.remoteGoAway = true
+			s.mu.Unlock()
+			if hdr.length() != goAwayNormal {
+				err = ErrSessionProtocol
+			}
+		default:
+			err = ErrInvalidFrameHeader
+		}
+		if err != nil {
+			s.closeWithError(err)
+			return
+		}
+	}
+}
+
+func (s *Session) handlePing(hdr frameHeader) {
+	id := hdr.length()
+	if hdr.flags()&frameFlagSYN != 0 {
+		s.queueControl(makeFrameHeader(frameTypePing, frameFlagACK, 0, id))
+		return
+	}
+	s.mu.Lock()
+	if ch, ok := s.pings[id]; ok {
+		close(ch)
+		delete(s.pings, id)
+	}
+	s.mu.Unlock()
+}
+
+func (s *Session) handleStreamFrame(hdr frameHeader) error {
+	id, flags := hdr.streamID(), hdr.flags()
+
+	var body []byte
+	if hdr.typ() == frameTypeData && hdr.length() > 0 {
+		if hdr.length() > s.opts.streamWindow {
+			return ErrSessionProtocol
+		}
+		body = make([]byte, hdr.length())
+		if _, err := io.ReadFull(s.conn, body); err != nil {
+			return err
+		}
+	}
+
+	if flags&frameFlagSYN != 0 {
+		return s.handleIncomingStream(hdr, body)
+	}
+
+	s.mu.Lock()
+	st := s.streams[id]
+	s.mu.Unlock()
+	if st == nil { // The stream is gone, drop it.
+		return nil
+	}
+	return st.handleFrame(hdr, body)
+}
+
+func (s *Session) handleIncomingStream(hdr frameHeader, body []byte) error {
+	id := hdr.streamID()
+	if id == 0 || (id%2 == 1) == s.isClient {
+		return ErrSessionProtocol
+	}
+
+	s.mu.Lock()
+	if _, ok := s.streams[id]; ok {
+		s.mu.Unlock()
+		return ErrSessionProtocol
+	}
+	if s.localGoAway {
+		s.mu.Unlock()
+		s.sendWindowUpdate(id, frameFlagRST, 0)
+		return nil
+	}
+	st := newStream(s, id)
+	s.streams[id] = st
+	s.mu.Unlock()
+
+	select {
+	case s.acceptc <- st:
+	default: // Backlog is full.
+		s.removeStream(id)
+		s.sendWindowUpdate(id, frameFlagRST, 0)
+		return nil
+	}
+	s.sendWindowUpdate(id, frameFlagACK, s.opts.streamWindow-initialStreamWindow)
+	return st.handleFrame(hdr, body)
+}
+
+func (s *Session) removeStream(id uint32) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+// Stream is a logical bidirectional stream within a Session.
+type Stream struct {
+	id      uint32
+	session *Session
+
+	mu           sync.Mutex
+	recvBuf      bytes.Buffer
+	recvWindow   uint32 // The credit granted to the remote end.
+	consumed     uint32 // The bytes read since last window update.
+	sendWindow   uint32
+	readClosed   bool
+	writeClosed  bool
+	remoteClosed bool
+	reset        bool
+
+	readNotify    chan struct{}
+	writeNotify   chan struct{}
+	readDeadline  pipeDeadline
+	writeDeadline pipeDeadline
+}
+
+func newStream(s *Session, id uint32) *Stream {
+	return &Stream{
+		id:            id,
+		session:       s,
+		recvWindow:    s.opts.streamWindow,
+		sendWindow:    initialStreamWindow,
+		readNotify:    make(chan struct{}, 1),
+		writeNotify:   make(chan struct{}, 1),
+		readDeadline:  makePipeDeadline(),
+		writeDeadline: makePipeDeadline(),
+	}
+}
+
+// ID returns the stream id.
+func (st *Stream) ID() uint32 {
+	return st.id
+}
+
+// Session returns the Session which the stream belongs to.
+func (st *Stream) Session() *Session {
+	return st.session
+}
+
+func (st *Stream) Read(p []byte) (int, error) {
+	for {
+		st.mu.Lock()
+		if st.readClosed {
+			st.mu.Unlock()
+			return 0, ErrStreamClosed
+		}
+		if st.recvBuf.Len() > 0 {
+			n, _ := st.recvBuf.Read(p)
+			st.consumed += uint32(n)
+			var delta uint32
+			if st.consumed >= st.session.opts.streamWindow/2 && !st.remoteClosed && !st.reset {
+				delta = st.consumed
+				st.recvWindow += delta
+				st.consumed = 0
+			}
+			st.mu.Unlock()
+			if delta > 0 {
+				st.session.sendWindowUpdate(st.id, 0, delta)
+			}
+			return n, nil
+		}
+		reset, remoteClosed := st.reset, st.remoteClosed
+		st.mu.Unlock()
+
+		switch {
+		case reset:
+			return 0, ErrStreamReset
+		case remoteClosed:
+			return 0, io.EOF
+		case st.session.isClosed():
+			return 0, ErrSessionClosed
+		}
+
+		select {
+		case <-st.readNotify:
+		case <-st.readDeadline.wait():
+			return 0, errTimeout
+		case <-st.session.closec:
+		}
+	}
+}
+
+func (st *Stream) Write(b []byte) (int, error) {
+	total := 0
+	for len(b) > 0 {
+		st.mu.Lock()
+		switch {
+		case st.reset:
+			st.mu.Unlock()
+			return total, ErrStreamReset
+		case st.writeClosed:
+			st.mu.Unlock()
+			return total, ErrStreamClosed
+		}
+		if st.sendWindow == 0 {
+			st.mu.Unlock()
+			select {
+			case <-st.writeNotify:
+				continue
+			case <-st.writeDeadline.wait():
+				return total, errTimeout
+			case <-st.session.closec:
+				return total, ErrSessionClosed
+			}
+		}
+		n := uint32(len(b))
+		if n > st.sendWindow {
+			n = st.sendWindow
+		}
+		if n > maxDataFrameSize {
+			n = maxDataFrameSize
+		}
+		st.sendWindow -= n
+		st.mu.Unlock()
+
+		hdr := makeFrameHeader(frameTypeData, 0, st.id, n)
+		req, err := st.session.handoff(hdr, b[:n], st.writeDeadline.wait())
+		if err != nil { // Not sent, return the credit.
+			st.mu.Lock()
+			st.sendWindow += n
+			st.mu.Unlock()
+			st.notifyAll()
+			return total, err
+		}
+		if err := st.session.waitSent(req); err != nil {
+			return total, err
+		}
+		total += int(n)
+		b = b[n:]
+	}
+	return total, nil
+}
+
+// CloseWrite half-closes the stream, the remote end reads io.EOF after
+// the data has been consumed.
+func (st *Stream) CloseWrite() error {
+	st.mu.Lock()
+	if st.writeClosed || st.reset {
+		st.mu.Unlock()
+		return ErrStreamClosed
+	}
+	st.writeClosed = true
+	done := st.remoteClosed
+	st.mu.Unlock()
+
+	st.session.sendWindowUpdate(st.id, frameFlagFIN, 0)
+	if done {
+		st.session.removeStream(st.id)
+	}
+	st.notifyAll()
+	return nil
+}
+
+// Close closes both directions of the stream, the data received
+// afterwards is discarded.
+func (st *Stream) Close() error {
+	st.mu.Lock()
+	if st.readClosed {
+		st.mu.Unlock()
+		return ErrStreamClosed
+	}
+	st.readClosed = true
+	// Return the credit of the buffered data since nobody reads it.
+	delta := uint32(st.recvBuf.Len()) + st.consumed
+	st.recvBuf.Reset()
+	st.consumed = 0
+	st.recvWindow += delta
+	sendFIN := !st.writeClosed && !st.reset
+	st.writeClosed = true
+	done := st.remoteClosed || st.reset
+	st.mu.Unlock()
+
+	if sendFIN {
+		st.session.sendWindowUpdate(st.id, frameFlagFIN, delta)
+	} else if delta > 0 && !done {
+		st.session.sendWindowUpdate(st.id, 0, delta)
+	}
+	if done {
+		st.session.removeStream(st.id)
+	}
+	st.notifyAll()
+	return nil
+}
+
+// Reset closes the stream abruptly, the remote end gets ErrStreamReset.
+func (st *Stream) Reset() error {
+	st.mu.Lock()
+	if st.reset {
+		st.mu.Unlock()
+		return nil
+	}
+	st.reset = true
+	st.mu.Unlock()
+
+	st.session.sendWindowUpdate(st.id, frameFlagRST, 0)
+	st.session.removeStream(st.id)
+	st.notifyAll()
+	return nil
+}
+
+func (st *Stream) LocalAddr() net.Addr {
+	return st.session.conn.LocalAddr()
+}
+
+func (st *Stream) RemoteAddr() net.Addr {
+	return st.session.conn.RemoteAddr()
+}
+
+func (st *Stream) SetDeadline(t time.Time) error {
+	st.readDeadline.set(t)
+	st.writeDeadline.set(t)
+	return nil
+}
+
+func (st *Stream) SetReadDeadline(t time.Time) error {
+	st.readDeadline.set(t)
+	return nil
+}
+
+func (st *Stream) SetWriteDeadline(t time.Time) error {
+	st.writeDeadline.set(t)
+	return nil
+}
+
+func (st *Stream) handleFrame(hdr frameHeader, body []byte) error {
+	flags := hdr.flags()
+
+	st.mu.Lock()
+	if hdr.typ() == frameTypeWindowUpdate {
+		st.sendWindow += hdr.length()
+	} else if len(body) > 0 {
+		n := uint32(len(body))
+		if n > st.recvWindow {
+			st.mu.Unlock()
+			return ErrSessionProtocol
+		}
+		st.recvWindow -= n
+		if st.readClosed {
+			// Nobody reads it, return the credit immediately.
+			st.recvWindow += n
+			defer st.session.sendWindowUpdate(st.id, 0, n)
+		} else {
+			_, _ = st.recvBuf.Write(body)
+		}
+	}
+	if flags&frameFlagFIN != 0 {
+		st.remoteClosed = true
+	}
+	if flags&frameFlagRST != 0 {
+		st.reset = true
+	}
+	done := st.reset || (st.remoteClosed && st.writeClosed)
+	st.mu.Unlock()
+
+	if done {
+		st.session.removeStream(st.id)
+	}
+	st.notifyAll()
+	return nil
+}
+
+func (st *Stream) notifyAll() {
+	select {
+	case st.readNotify <- struct{}{}:
+	default:
+	}
+	select {
+	case st.writeNotify <- struct{}{}:
+	default:
+	}
+}
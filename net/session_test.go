@@ -0,0 +1,192 @@
+package net
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSessionPair(t *testing.T, opts ...WithSessionOption) (*Session, *Session) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	connc := make(chan net.Conn, 1)
+	go func() {
+		conn, _ := l.Accept()
+		connc <- conn
+	}()
+	cconn, err := net.Dial("tcp", l.Addr().String())
+	require.Nil(t, err)
+	sconn := <-connc
+	require.NotNil(t, sconn)
+	return NewClientSession(cconn, opts...), NewServerSession(sconn, opts...)
+}
+
+func TestSessionStreams(t *testing.T) {
+	client, server := newSessionPair(t)
+	defer client.Close()
+	s := NewServerFromListener(server, func(_ context.Context, conn net.Conn) {
+		defer conn.Close()
+		_, _ = io.Copy(conn, conn)
+	})
+	go s.Serve()
+	defer s.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		data := make([]byte, 1024*1024+i) // Larger than the window.
+		rand.Read(data)
+		st, err := client.OpenStream()
+		require.Nil(t, err)
+		require.Equal(t, uint32(2*i+1), st.ID())
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			go func() {
+				_, _ = st.Write(data)
+				_ = st.CloseWrite()
+			}()
+			got, err := ioutil.ReadAll(st)
+			require.Nil(t, err)
+			require.True(t, bytes.Equal(data, got))
+			require.Nil(t, st.Close())
+		}()
+	}
+	wg.Wait()
+
+	rtt, err := client.Ping()
+	require.Nil(t, err)
+	require.True(t, rtt > 0)
+	require.Equal(t, 0, client.NumStreams())
+}
+
+func TestSessionGoAway(t *testing.T) {
+	client, server := newSessionPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	require.Nil(t, server.GoAway())
+	for i := 0; ; i++ {
+		st, err := client.OpenStream()
+		if err != nil {
+			require.Equal(t, ErrSessionGoAway, err)
+			break
+		}
+		_, err = st.Read(make([]byte, 1))
+		require.Equal(t, ErrStreamReset, err)
+		require.True(t, i < 100)
+	}
+
+	// The server side is still able to open streams.
+	st, err := server.OpenStream()
+	require.Nil(t, err)
+	require.Equal(t, uint32(2), st.ID())
+	_, err = st.Write([]byte("hello"))
+	require.Nil(t, err)
+	cst, err := client.AcceptStream()
+	require.Nil(t, err)
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(cst, buf)
+	require.Nil(t, err)
+	require.Equal(t, "hello", string(buf))
+}
+
+func TestStreamDeadlineAndReset(t *testing.T) {
+	client, server := newSessionPair(t)
+	defer client.Close()
+	defer server.Close()
+
+	st, err := client.OpenStream()
+	require.Nil(t, err)
+	_, err = st.Write([]byte("x"))
+	require.Nil(t, err)
+	sst, err := server.AcceptStream()
+	require.Nil(t, err)
+
+	require.Nil(t, sst.SetReadDeadline(time.Now().Add(20*time.Millisecond)))
+	buf := make([]byte, 2)
+	n, err := sst.Read(buf)
+	require.Nil(t, err)
+	require.Equal(t, "x", string(buf[:n]))
+	_, err = sst.Read(buf)
+	nerr, ok := err.(net.Error)
+	require.True(t, ok)
+	require.True(t, nerr.Timeout())
+
+	require.Nil(t, st.Reset())
+	require.Nil(t, sst.SetReadDeadline(time.Time{}))
+	_, err = sst.Read(buf)
+	require.Equal(t, ErrStreamReset, err)
+	_, err = sst.Write(buf)
+	require.Equal(t, ErrStreamReset, err)
+	_, err = st.Write(buf)
+	require.Equal(t, ErrStreamReset, err)
+
+	st, err = client.OpenStream()
+	require.Nil(t, err)
+	sst, err = server.AcceptStream()
+	require.Nil(t, err)
+	require.Nil(t, server.Close())
+	_, err = sst.Read(buf)
+	require.Equal(t, ErrSessionClosed, err)
+	_, err = st.Read(buf)
+	require.NotNil(t, err)
+	<-client.CloseChan()
+	_, err = client.OpenStream()
+	require.Equal(t, ErrSessionClosed, err)
+	_, err = client.Accept()
+	require.Equal(t, ErrSessionClosed, err)
+}
+
+func TestSessionKeepAliveTimeout(t *testing.T) {
+	cconn, sconn := net.Pipe()
+	defer sconn.Close()
+	go func() { _, _ = io.Copy(ioutil.Discard, sconn) }()
+
+	client := NewClientSession(cconn, WithSessionKeepAlive(10*time.Millisecond, 20*time.Millisecond))
+	select {
+	case <-client.CloseChan():
+	case <-time.After(time.Second):
+		t.Fatal("keepalive does not work")
+	}
+	require.Equal(t, ErrKeepAliveTimeout, client.Err())
+}
+
+func TestStreamWriteTimeoutKeepWindow(t *testing.T) {
+	c1, c2 := MemPipe(WithMemPipeBufferSize(1024))
+	defer c2.Close() // Never reads.
+	client := NewClientSession(c1)
+	defer client.Close()
+
+	st1, err := client.OpenStream()
+	require.Nil(t, err)
+	go func() { _, _ = st1.Write(make([]byte, 4096)) }() // Blocks the sender.
+	st2, err := client.OpenStream()
+	require.Nil(t, err)
+	for i := 0; ; i++ {
+		require.True(t, i < 100, "the sender is not blocked")
+		st2.mu.Lock()
+		window := st2.sendWindow
+		st2.mu.Unlock()
+		require.Nil(t, st2.SetWriteDeadline(time.Now().Add(10*time.Millisecond)))
+		if _, err = st2.Write(make([]byte, 100)); err == nil {
+			continue
+		}
+		nerr, ok := err.(net.Error)
+		require.True(t, ok)
+		require.True(t, nerr.Timeout())
+		st2.mu.Lock()
+		require.Equal(t, window, st2.sendWindow)
+		st2.mu.Unlock()
+		break
+	}
+}